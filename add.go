@@ -0,0 +1,104 @@
+package elastichash
+
+// addKey inserts key with a single probe pass: find both detects an existing
+// key and returns the slot Insert would use, so nothing is walked twice.
+func addKey(t slotTable, key int) (bool, error) {
+	if key == EMPTY || key == TOMBSTONE {
+		return false, t.fail(ErrInvalidKey, -1)
+	}
+	ref, found := t.find(key)
+	if found {
+		return false, nil
+	}
+	if t.Size() >= t.Capacity() {
+		return false, t.fail(ErrFull, -1)
+	}
+	if ref.lvl < 0 {
+		return false, t.noSlot()
+	}
+	t.own(ref.lvl)
+	t.segment(ref.lvl)[ref.pos] = key
+	t.addSize(1)
+	return true, nil
+}
+
+// replaceKey swaps old for new, see ElasticHashTable.Replace.
+func replaceKey(t slotTable, old, new int) (bool, error) {
+	if new == EMPTY || new == TOMBSTONE {
+		return false, t.fail(ErrInvalidKey, -1)
+	}
+	ref, found := t.find(old)
+	if !found || old == new {
+		return found, nil
+	}
+	t.own(ref.lvl)
+	t.segment(ref.lvl)[ref.pos] = TOMBSTONE
+	t.addSize(-1)
+	if _, err := addKey(t, new); err != nil {
+		// The tombstone is the only change so far; undoing it restores
+		// the exact previous layout.
+		t.segment(ref.lvl)[ref.pos] = old
+		t.addSize(1)
+		return false, err
+	}
+	return true, nil
+}
+
+// Add inserts key and reports whether it was newly added, in a single probe
+// pass. Unlike Insert followed by a separate Contains, the answer cannot be
+// invalidated by another writer in between.
+func (ht *ElasticHashTable) Add(key int) (added bool, err error) {
+	return ht.insert(key)
+}
+
+// LoadOrStore inserts key unless it is present, in the manner of
+// sync.Map.LoadOrStore: loaded reports whether key was already in the table.
+func (ht *ElasticHashTable) LoadOrStore(key int) (loaded bool, err error) {
+	added, err := ht.Add(key)
+	return err == nil && !added, err
+}
+
+// Replace removes old and inserts new as one operation, reporting whether old
+// was present. Nothing changes if old is absent. If new is already present,
+// old is simply removed. If new cannot be placed, old is left in place and
+// the error is returned.
+func (ht *ElasticHashTable) Replace(old, new int) (replaced bool, err error) {
+	if ht.readOnly {
+		return false, ht.fail(ErrReadOnly, -1)
+	}
+	replaced, err = replaceKey(ht, old, new)
+	if replaced && old != new {
+		ht.addToFilter(new)
+		ht.indexRemove(old)
+		ht.indexAdd(new)
+	}
+	return replaced, err
+}
+
+// Add inserts key and reports whether it was newly added, see
+// ElasticHashTable.Add.
+func (ht *FunnelHashTable) Add(key int) (added bool, err error) {
+	return ht.insert(key)
+}
+
+// LoadOrStore inserts key unless it is present, see
+// ElasticHashTable.LoadOrStore.
+func (ht *FunnelHashTable) LoadOrStore(key int) (loaded bool, err error) {
+	added, err := ht.Add(key)
+	return err == nil && !added, err
+}
+
+// Replace removes old and inserts new as one operation, see
+// ElasticHashTable.Replace.
+func (ht *FunnelHashTable) Replace(old, new int) (replaced bool, err error) {
+	if ht.readOnly {
+		return false, ht.fail(ErrReadOnly, -1)
+	}
+	replaced, err = replaceKey(ht, old, new)
+	if replaced && old != new {
+		ht.addToFilter(new)
+		ht.indexRemove(old)
+		ht.indexAdd(new)
+	}
+	return replaced, err
+}
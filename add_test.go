@@ -0,0 +1,81 @@
+package elastichash
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestAddLoadOrStoreReplace(t *testing.T) {
+	forEachTable[testTable](t, NewElasticHashTable(200, 0.1), NewFunnelHashTable(200, 4, 0.1), func(t *testing.T, ht testTable) {
+		if added, err := ht.Add(7); !added || err != nil {
+			t.Errorf("First Add(7) = %v, %v", added, err)
+		}
+		if added, err := ht.Add(7); added || err != nil {
+			t.Errorf("Second Add(7) = %v, %v", added, err)
+		}
+		if loaded, err := ht.LoadOrStore(7); !loaded || err != nil {
+			t.Errorf("LoadOrStore(7) = %v, %v", loaded, err)
+		}
+		if loaded, err := ht.LoadOrStore(8); loaded || err != nil || !ht.Contains(8) {
+			t.Errorf("LoadOrStore(8) = %v, %v", loaded, err)
+		}
+		if ht.Size() != 2 {
+			t.Errorf("Expected size 2, got %d", ht.Size())
+		}
+
+		if ok, err := ht.Replace(7, 9); !ok || err != nil || ht.Contains(7) || !ht.Contains(9) {
+			t.Errorf("Replace(7, 9) = %v, %v", ok, err)
+		}
+		if ok, _ := ht.Replace(7, 10); ok || ht.Contains(10) {
+			t.Errorf("Replace of an absent key should do nothing")
+		}
+		if ok, _ := ht.Replace(9, 8); !ok || ht.Contains(9) || !ht.Contains(8) || ht.Size() != 1 {
+			t.Errorf("Replace onto a present key should just remove the old one")
+		}
+		if _, err := ht.Add(EMPTY); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Add(EMPTY): expected ErrInvalidKey, got %v", err)
+		}
+
+		// Add reports ErrFull, and a failed Replace leaves the table as it was
+		for k := 100; ht.Size() < ht.Capacity(); k++ {
+			ht.Add(k)
+		}
+		if _, err := ht.Add(5000); !errors.Is(err, ErrFull) {
+			t.Errorf("Add to a full table: expected ErrFull, got %v", err)
+		}
+		before, _ := ht.MarshalBinary()
+		if _, err := ht.Replace(8, EMPTY); err == nil {
+			t.Errorf("Replace with an invalid key should fail")
+		}
+		after, _ := ht.MarshalBinary()
+		if string(before) != string(after) {
+			t.Errorf("Failed Replace changed the table")
+		}
+	})
+}
+
+func TestShardedAdd(t *testing.T) {
+	// Concurrent Adds of the same keys: each key is added by exactly one caller
+	st := NewShardedElasticTable(2, 4000, 0.1)
+	var added int64
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := 0; k < 1000; k++ {
+				if ok, err := st.Add(k); err != nil {
+					t.Errorf("Add(%d): %v", k, err)
+				} else if ok {
+					atomic.AddInt64(&added, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if added != 1000 || st.Size() != 1000 {
+		t.Errorf("Expected 1000 keys added once each, got %d added, size %d", added, st.Size())
+	}
+}
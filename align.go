@@ -0,0 +1,54 @@
+package elastichash
+
+import "unsafe"
+
+// cacheLineSize is the cache line size assumed by the aligned funnel layout.
+const cacheLineSize = 64
+
+// slotsPerLine is the number of int slots in a cache line.
+const slotsPerLine = cacheLineSize / int(unsafe.Sizeof(int(0)))
+
+// bucketStride returns the distance in slots between the starts of two
+// consecutive buckets of size b. Unaligned buckets are packed. Aligned
+// buckets are padded to a power of two that divides the cache line, so that
+// no bucket straddles two lines, or for b larger than a line to a whole
+// number of lines, so that a bucket spans as few lines as possible.
+func bucketStride(b int, aligned bool) int {
+	if !aligned {
+		return b
+	}
+	if b > slotsPerLine {
+		return (b + slotsPerLine - 1) / slotsPerLine * slotsPerLine
+	}
+	stride := 1
+	for stride < b {
+		stride <<= 1
+	}
+	return stride
+}
+
+// alignedSlots returns n slots starting on a cache line boundary, filled
+// with EMPTY. The slice points into a slightly larger allocation; the
+// garbage collector keeps it alive through the interior pointer.
+func alignedSlots(n int) []int {
+	buf := make([]int, n+slotsPerLine-1)
+	off := 0
+	if rem := int(uintptr(unsafe.Pointer(&buf[0])) % cacheLineSize); rem != 0 {
+		off = (cacheLineSize - rem) / int(unsafe.Sizeof(int(0)))
+	}
+	s := buf[off : off+n : off+n]
+	for i := range s {
+		s[i] = EMPTY
+	}
+	return s
+}
+
+// cloneSlots copies s, keeping the copy cache line aligned if aligned is set.
+func cloneSlots(s []int, aligned bool) []int {
+	if !aligned {
+		return append([]int(nil), s...)
+	}
+	c := alignedSlots(len(s))
+	copy(c, s)
+	return c
+}
@@ -0,0 +1,76 @@
+package elastichash
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestBucketStride(t *testing.T) {
+	for _, tc := range []struct{ b, want int }{
+		{1, 1}, {2, 2}, {3, 4}, {4, 4}, {5, 8}, {8, 8}, {9, 16}, {16, 16}, {17, 24},
+	} {
+		if got := bucketStride(tc.b, true); got != tc.want {
+			t.Errorf("bucketStride(%d) = %d, want %d", tc.b, got, tc.want)
+		}
+		if got := bucketStride(tc.b, false); got != tc.b {
+			t.Errorf("Packed bucketStride(%d) = %d", tc.b, got)
+		}
+	}
+}
+
+func TestAlignedFunnel(t *testing.T) {
+	isAligned := func(s []int) bool {
+		return uintptr(unsafe.Pointer(&s[0]))%cacheLineSize == 0
+	}
+	for _, b := range []int{3, 4, 6, 8} {
+		ht := NewFunnelHashTableWithOptions(2000, b, 0.1, FunnelOptions{Aligned: true})
+		for _, lvl := range ht.levels {
+			if !isAligned(lvl.slots) || len(lvl.slots) != lvl.numBuckets*ht.stride {
+				t.Fatalf("b=%d: level of %d slots not laid out on cache lines", b, len(lvl.slots))
+			}
+		}
+		for k := 0; ht.Size() < ht.Capacity(); k++ {
+			if err := ht.Insert(k); err != nil {
+				t.Fatalf("b=%d: Insert(%d): %v", b, k, err)
+			}
+		}
+		// Padding slots are never used
+		for _, lvl := range ht.levels {
+			for i, v := range lvl.slots {
+				if i%ht.stride >= b && v != EMPTY {
+					t.Fatalf("b=%d: padding slot %d holds %d", b, i, v)
+				}
+			}
+		}
+		for k := 0; k < ht.Size(); k++ {
+			if !ht.Contains(k) {
+				t.Fatalf("b=%d: key %d missing", b, k)
+			}
+		}
+
+		// Copies made for snapshots and decoding keep the layout
+		snap := ht.Snapshot()
+		ht.Remove(0)
+		if !snap.Contains(0) || ht.Contains(0) {
+			t.Errorf("b=%d: snapshot not isolated", b)
+		}
+		for _, lvl := range ht.levels {
+			if !isAligned(lvl.slots) {
+				t.Errorf("b=%d: copied level lost its alignment", b)
+			}
+		}
+		data, _ := ht.MarshalBinary()
+		var dec FunnelHashTable
+		if err := dec.UnmarshalBinary(data); err != nil {
+			t.Fatalf("b=%d: UnmarshalBinary: %v", b, err)
+		}
+		if !dec.aligned || dec.stride != ht.stride || !isAligned(dec.levels[0].slots) {
+			t.Errorf("b=%d: decoded table lost the aligned layout", b)
+		}
+		for k := 1; k < ht.Size(); k++ {
+			if !dec.Contains(k) {
+				t.Fatalf("b=%d: decoded table misses key %d", b, k)
+			}
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package elastichash
+
+// slotTable is the slot-level access shared by ElasticHashTable and
+// FunnelHashTable, for operations implemented once for both.
+type slotTable interface {
+	Table
+	find(key int) (slotRef, bool)
+	own(lvl int)
+	segment(lvl int) []int
+	numSegments() int
+	addSize(n int)
+	fail(err error, level int) error
+	noSlot() error
+}
+
+// undoEntry records the previous content of a slot written by a batch.
+type undoEntry struct {
+	ref  slotRef
+	prev int
+}
+
+// insertBatch places every key of keys that is not yet in t, allowing at most
+// room new keys. Each key costs a single probe pass, which also catches
+// duplicates within the batch. If the batch cannot be placed completely, every
+// slot written so far is restored, newest first, so that probe sequences see
+// exactly the previous contents, and the error is returned.
+// The caller adds the returned count to the table size.
+func insertBatch(t slotTable, keys []int, room int) (int, error) {
+	var undo []undoEntry
+	for _, key := range keys {
+		var err error
+		if key == EMPTY || key == TOMBSTONE {
+			err = t.fail(ErrInvalidKey, -1)
+		}
+		ref, found := t.find(key)
+		switch {
+		case err != nil:
+		case found:
+			continue
+		case len(undo) == room:
+			err = t.fail(ErrFull, -1)
+		case ref.lvl < 0:
+			err = t.noSlot()
+		}
+		if err != nil {
+			for i := len(undo) - 1; i >= 0; i-- {
+				u := undo[i]
+				t.segment(u.ref.lvl)[u.ref.pos] = u.prev
+			}
+			return 0, err
+		}
+		if undo == nil {
+			undo = make([]undoEntry, 0, len(keys))
+		}
+		t.own(ref.lvl)
+		seg := t.segment(ref.lvl)
+		undo = append(undo, undoEntry{ref, seg[ref.pos]})
+		seg[ref.pos] = key
+	}
+	return len(undo), nil
+}
+
+// removeBatch tombstones every key of keys present in t and returns how many
+// were removed. The caller adjusts the table size.
+func removeBatch(t slotTable, keys []int) int {
+	removed := 0
+	for _, key := range keys {
+		ref, found := t.find(key)
+		if !found {
+			continue
+		}
+		t.own(ref.lvl)
+		t.segment(ref.lvl)[ref.pos] = TOMBSTONE
+		removed++
+	}
+	return removed
+}
+
+// InsertBatch inserts keys as a single unit: either every key that is not
+// already present is added, or the table is left exactly as it was and an
+// error is returned (for instance when it would fill up part way through).
+// Keys already in the table and repeated keys are ignored. The capacity is
+// checked and the size updated once for the whole batch. That is all the
+// batch saves: each key is hashed and placed exactly as by Insert, since no
+// hashing work carries over from one key to another.
+func (ht *ElasticHashTable) InsertBatch(keys []int) error {
+	if ht.readOnly {
+		return ht.fail(ErrReadOnly, -1)
+	}
+	room := ht.capacity - ht.Size()
+	added, err := insertBatch(ht, keys, room)
+	if err != nil {
+		return err
+	}
+	ht.addSize(added)
+	if ht.filter != nil {
+		for _, key := range keys {
+			ht.addToFilter(key)
+		}
+	}
+	if ht.index != nil && added > 0 {
+		for _, key := range keys {
+			ht.indexAdd(key)
+		}
+	}
+	return nil
+}
+
+// RemoveBatch removes every key of keys that is present and returns how many
+// were removed. Removal cannot fail part way; a read-only table removes
+// nothing and returns 0.
+func (ht *ElasticHashTable) RemoveBatch(keys []int) int {
+	if ht.readOnly {
+		return 0
+	}
+	removed := removeBatch(ht, keys)
+	ht.addSize(-removed)
+	if ht.index != nil && removed > 0 {
+		for _, key := range keys {
+			ht.indexRemove(key)
+		}
+	}
+	return removed
+}
+
+// InsertBatch inserts keys as a single unit, see ElasticHashTable.InsertBatch.
+func (ht *FunnelHashTable) InsertBatch(keys []int) error {
+	if ht.readOnly {
+		return ht.fail(ErrReadOnly, -1)
+	}
+	room := ht.capacity - ht.Size()
+	added, err := insertBatch(ht, keys, room)
+	if err != nil {
+		return err
+	}
+	ht.addSize(added)
+	if ht.filter != nil {
+		for _, key := range keys {
+			ht.addToFilter(key)
+		}
+	}
+	if ht.index != nil && added > 0 {
+		for _, key := range keys {
+			ht.indexAdd(key)
+		}
+	}
+	return nil
+}
+
+// RemoveBatch removes every key of keys that is present and returns how many
+// were removed, see ElasticHashTable.RemoveBatch.
+func (ht *FunnelHashTable) RemoveBatch(keys []int) int {
+	if ht.readOnly {
+		return 0
+	}
+	removed := removeBatch(ht, keys)
+	ht.addSize(-removed)
+	if ht.index != nil && removed > 0 {
+		for _, key := range keys {
+			ht.indexRemove(key)
+		}
+	}
+	return removed
+}
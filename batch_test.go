@@ -0,0 +1,95 @@
+package elastichash
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBatchOperations(t *testing.T) {
+	forEachTable[testTable](t, NewElasticHashTable(200, 0.25), NewFunnelHashTable(200, 4, 0.25), func(t *testing.T, ht testTable) {
+		ht.Insert(1)
+		ht.Insert(2)
+
+		// Existing keys and repeats within the batch are skipped
+		if err := ht.InsertBatch([]int{1, 2, 3, 4, 3, 5, 5}); err != nil {
+			t.Fatal(err)
+		}
+		if ht.Size() != 5 {
+			t.Errorf("Expected size 5 after batch, got %d", ht.Size())
+		}
+		for k := 1; k <= 5; k++ {
+			if !ht.Contains(k) {
+				t.Errorf("Expected key %d after batch", k)
+			}
+		}
+		if n := ht.RemoveBatch([]int{2, 4, 100, 4}); n != 2 {
+			t.Errorf("RemoveBatch should remove 2 keys, removed %d", n)
+		}
+		if ht.Size() != 3 || ht.Contains(2) || ht.Contains(4) {
+			t.Errorf("Unexpected state after RemoveBatch: size %d", ht.Size())
+		}
+
+		// A batch that overflows the table is rolled back completely,
+		// down to which slots are EMPTY and which are TOMBSTONE
+		before, _ := ht.MarshalBinary()
+		big := make([]int, ht.Capacity())
+		for i := range big {
+			big[i] = 1000 + i
+		}
+		if err := ht.InsertBatch(big); err == nil {
+			t.Fatalf("Batch larger than the free room should fail")
+		}
+		after, _ := ht.MarshalBinary()
+		if !bytes.Equal(before, after) {
+			t.Errorf("Failed batch must leave the table unchanged")
+		}
+
+		// The same batch minus the overflow fits
+		room := ht.Capacity() - ht.Size()
+		if err := ht.InsertBatch(big[:room]); err != nil {
+			t.Fatalf("Batch that fits exactly failed: %v", err)
+		}
+		if ht.Size() != ht.Capacity() {
+			t.Errorf("Expected a full table, size %d of %d", ht.Size(), ht.Capacity())
+		}
+		for _, k := range big[:room] {
+			if !ht.Contains(k) {
+				t.Errorf("Expected key %d after batch", k)
+			}
+		}
+	})
+}
+
+func BenchmarkInsertBatch(b *testing.B) {
+	const N = 10000
+	keys := make([]int, int(N*0.85))
+	for i := range keys {
+		keys[i] = i * 7919
+	}
+	b.Run("ElasticHash-Insert", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			eht := NewElasticHashTable(N, 0.1)
+			for _, k := range keys {
+				eht.Insert(k)
+			}
+		}
+	})
+	b.Run("ElasticHash-InsertBatch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			NewElasticHashTable(N, 0.1).InsertBatch(keys)
+		}
+	})
+	b.Run("FunnelHash-Insert", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			fht := NewFunnelHashTable(N, 8, 0.1)
+			for _, k := range keys {
+				fht.Insert(k)
+			}
+		}
+	})
+	b.Run("FunnelHash-InsertBatch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			NewFunnelHashTable(N, 8, 0.1).InsertBatch(keys)
+		}
+	})
+}
@@ -0,0 +1,170 @@
+package elastichash
+
+import "math"
+
+// NewElasticHashTableFrom builds an ElasticHashTable holding keys in one pass.
+// The table is sized from len(keys) so that the keys fill a (1-delta)
+// fraction of it. Keys are placed level by level on the fresh table: every
+// key tries the first level before any key moves on to the next one. This
+// gives the same layout as inserting the keys one by one in the given order,
+// but skips the separate duplicate lookup and the per-key capacity check of
+// Insert. Repeated keys are detected while probing and stored once.
+func NewElasticHashTableFrom(keys []int, delta float64) (*ElasticHashTable, error) {
+	return newElasticFrom(keys, len(keys), delta, ElasticOptions{})
+}
+
+// newElasticFrom is NewElasticHashTableFrom for a table tuned by opts and
+// sized for n keys, n >= len(keys), to leave room for later insertions.
+func newElasticFrom(keys []int, n int, delta float64, opts ElasticOptions) (*ElasticHashTable, error) {
+	if delta < 0 || delta >= 1 {
+		return nil, invalidParams(KindElastic, "delta must be in (0,1)")
+	}
+	if opts.Probes < 0 {
+		return nil, invalidParams(KindElastic, "probe count must not be negative")
+	}
+	ht := NewElasticHashTableWithOptions(slotsFor(n, delta), delta, opts)
+	size := 0
+
+	pending := make([]int, 0, len(keys))
+	for _, key := range keys {
+		if key == EMPTY || key == TOMBSTONE {
+			return nil, ht.fail(ErrInvalidKey, -1)
+		}
+		pending = append(pending, key)
+	}
+	for i := 0; i < ht.L-1 && len(pending) > 0; i++ {
+		level := ht.levels[i]
+		m := len(level)
+		rest := pending[:0]
+	nextKey:
+		for _, key := range pending {
+			seq := ht.probes(key, i, m)
+			for attempt := 0; attempt < ht.R; attempt++ {
+				pos := seq.at(attempt)
+				if !seq.fresh(pos) {
+					continue
+				}
+				switch level[pos] {
+				case key:
+					continue nextKey // repeated key, already placed
+				case EMPTY:
+					level[pos] = key
+					size++
+					continue nextKey
+				}
+			}
+			rest = append(rest, key)
+		}
+		pending = rest
+	}
+
+	// Whatever is left goes to the last level by linear probing
+	lastLevel := ht.L - 1
+	level := ht.levels[lastLevel]
+	m := len(level)
+	for _, key := range pending {
+		pos := ht.hashFunc(key, lastLevel, 0, m)
+		for n := 0; level[pos] != EMPTY && level[pos] != key; n++ {
+			if n == m {
+				ht.size = int32(size)
+				return nil, ht.noSlot()
+			}
+			if pos++; pos == m {
+				pos = 0
+			}
+		}
+		if level[pos] == EMPTY {
+			level[pos] = key
+			size++
+		}
+	}
+	ht.size = int32(size)
+	return ht, nil
+}
+
+// NewFunnelHashTableFrom builds a FunnelHashTable with bucket size b holding
+// keys in one pass, see NewElasticHashTableFrom. The table is sized as by
+// NewFunnelForCapacity, which for small buckets or delta near zero leaves
+// more than the delta fraction free so that the overflow fits in the special
+// array.
+func NewFunnelHashTableFrom(keys []int, b int, delta float64) (*FunnelHashTable, error) {
+	return newFunnelFrom(keys, len(keys), b, delta, FunnelOptions{})
+}
+
+// newFunnelFrom is NewFunnelHashTableFrom for a table tuned by opts and
+// sized for n keys, see newElasticFrom.
+func newFunnelFrom(keys []int, n, b int, delta float64, opts FunnelOptions) (*FunnelHashTable, error) {
+	if delta < 0 || delta >= 1 {
+		return nil, invalidParams(KindFunnel, "delta must be in (0,1)")
+	}
+	if b < 1 {
+		return nil, invalidParams(KindFunnel, "bucket size must be positive")
+	}
+	ht := NewFunnelHashTableWithOptions(funnelSlotsFor(n, b, delta), b, delta, opts)
+	size := 0
+
+	type entry struct {
+		key int
+		h   uint32
+	}
+	pending := make([]entry, 0, len(keys))
+	for _, key := range keys {
+		if key == EMPTY || key == TOMBSTONE {
+			return nil, ht.fail(ErrInvalidKey, -1)
+		}
+		pending = append(pending, entry{key, mixKey(key)})
+	}
+	for i := range ht.levels {
+		slots := ht.levels[i].slots
+		rest := pending[:0]
+	nextKey:
+		for _, e := range pending {
+			start := ht.bucket(e.h, i) * ht.stride
+			for j := start; j < start+b; j++ {
+				switch slots[j] {
+				case e.key:
+					continue nextKey // repeated key, already placed
+				case EMPTY:
+					slots[j] = e.key
+					size++
+					continue nextKey
+				}
+			}
+			rest = append(rest, e)
+		}
+		pending = rest
+	}
+
+	m := len(ht.special)
+	for _, e := range pending {
+		pos := ht.specialStart(e.key)
+		for n := 0; ht.special[pos] != EMPTY && ht.special[pos] != e.key; n++ {
+			if n == m {
+				ht.size = int32(size)
+				return nil, ht.noSlot()
+			}
+			if pos++; pos == m {
+				pos = 0
+			}
+		}
+		if ht.special[pos] == EMPTY {
+			ht.special[pos] = e.key
+			size++
+		}
+	}
+	ht.size = int32(size)
+	return ht, nil
+}
+
+// slotsFor returns the smallest total size N for which a table built with
+// delta has capacity for n elements. delta must be in [0,1).
+func slotsFor(n int, delta float64) int {
+	N := int(math.Ceil(float64(n) / (1 - delta)))
+	for int((1-delta)*float64(N)) < n {
+		N++
+	}
+	if N < 1 {
+		N = 1
+	}
+	return N
+}
@@ -0,0 +1,144 @@
+package elastichash
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestBulkConstructors(t *testing.T) {
+	keys := make([]int, 0, 3000)
+	for i := 0; i < 2500; i++ {
+		keys = append(keys, rand.Intn(1<<40))
+	}
+	keys = append(keys, keys[:500]...) // duplicates
+
+	eht, err := NewElasticHashTableFrom(keys, 0.1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fht, err := NewFunnelHashTableFrom(keys, 8, 0.1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[int]bool{}
+	var uniq []int
+	for _, k := range keys {
+		if !seen[k] {
+			seen[k] = true
+			uniq = append(uniq, k)
+		}
+	}
+	for _, ht := range []Table{eht, fht} {
+		if ht.Size() != len(uniq) {
+			t.Errorf("Expected size %d, got %d", len(uniq), ht.Size())
+		}
+		if ht.Capacity() < len(uniq) {
+			t.Errorf("Capacity %d is below the key count %d", ht.Capacity(), len(uniq))
+		}
+		for _, k := range keys {
+			if !ht.Contains(k) {
+				t.Errorf("Expected key %d after bulk load", k)
+			}
+		}
+		if ht.Contains(-5) || ht.Contains(1<<41) {
+			t.Errorf("Unexpected key found after bulk load")
+		}
+	}
+
+	// Same layout as inserting one by one in the given order
+	seqE := NewElasticHashTable(slotsFor(len(keys), 0.1), 0.1)
+	seqF := NewFunnelHashTable(funnelSlotsFor(len(keys), 8, 0.1), 8, 0.1)
+	for _, k := range keys {
+		seqE.Insert(k)
+		seqF.Insert(k)
+	}
+	a, _ := eht.MarshalBinary()
+	b, _ := seqE.MarshalBinary()
+	if !bytes.Equal(a, b) {
+		t.Errorf("Elastic bulk layout differs from sequential insertion")
+	}
+	a, _ = fht.MarshalBinary()
+	b, _ = seqF.MarshalBinary()
+	if !bytes.Equal(a, b) {
+		t.Errorf("Funnel bulk layout differs from sequential insertion")
+	}
+
+	// Bulk-built tables keep working as regular tables
+	if err := eht.Insert(-10); err != nil && eht.Size() < eht.Capacity() {
+		t.Errorf("Insert after bulk load failed: %v", err)
+	}
+	if !fht.Remove(uniq[0]) || fht.Contains(uniq[0]) {
+		t.Errorf("Remove after bulk load failed")
+	}
+
+	if _, err := NewElasticHashTableFrom([]int{1, EMPTY}, 0.1); err == nil {
+		t.Errorf("Marker values should be rejected as keys")
+	}
+	empty, err := NewFunnelHashTableFrom(nil, 4, 0.5)
+	if err != nil || empty.Size() != 0 || empty.Contains(0) {
+		t.Errorf("Bulk load of no keys should give an empty table: %v", err)
+	}
+	if empty, err := NewElasticHashTableFrom(nil, 0.5); err != nil || empty.Contains(0) {
+		t.Errorf("Bulk load of no keys should give an empty table: %v", err)
+	}
+}
+
+func TestBulkFunnelSmallBuckets(t *testing.T) {
+	for _, c := range []struct {
+		n, b  int
+		delta float64
+	}{
+		{1000, 1, 0.1},
+		{1000, 2, 0.1},
+		{1000, 8, 0},
+		{1000, 2, 0.01},
+		{100000, 4, 0.01},
+	} {
+		keys := make([]int, c.n)
+		for i := range keys {
+			keys[i] = rand.Int()
+		}
+		ht, err := NewFunnelHashTableFrom(keys, c.b, c.delta)
+		if err != nil {
+			t.Errorf("n=%d b=%d delta=%v: %v", c.n, c.b, c.delta, err)
+			continue
+		}
+		if ht.Size() != c.n {
+			t.Errorf("n=%d b=%d delta=%v: expected size %d, got %d", c.n, c.b, c.delta, c.n, ht.Size())
+		}
+	}
+}
+
+func BenchmarkBulkLoad(b *testing.B) {
+	keys := make([]int, 100000)
+	for i := range keys {
+		keys[i] = rand.Int()
+	}
+	b.Run("ElasticHash-Insert", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			eht := NewElasticHashTable(slotsFor(len(keys), 0.1), 0.1)
+			for _, k := range keys {
+				eht.Insert(k)
+			}
+		}
+	})
+	b.Run("ElasticHash-From", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			NewElasticHashTableFrom(keys, 0.1)
+		}
+	})
+	b.Run("FunnelHash-Insert", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			fht := NewFunnelHashTable(funnelSlotsFor(len(keys), 8, 0.1), 8, 0.1)
+			for _, k := range keys {
+				fht.Insert(k)
+			}
+		}
+	})
+	b.Run("FunnelHash-From", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			NewFunnelHashTableFrom(keys, 8, 0.1)
+		}
+	})
+}
@@ -0,0 +1,267 @@
+package elastichash
+
+import (
+	"math/bits"
+	"sync"
+)
+
+// Cache is a fixed-memory key-value cache using the funnel hashing layout:
+// a key may only live in one bucket per level, so every operation touches at
+// most levels*b slots. Instead of failing once Capacity entries are stored,
+// Put evicts an entry chosen by the CLOCK algorithm among the slots the new
+// key may occupy: each slot carries a reference bit that Get sets, and the
+// clock hand clears set bits until it finds an entry that was not used since
+// its last pass.
+//
+// The special overflow array of FunnelHashTable is not used, so that probe
+// costs stay bounded. A Cache is safe for concurrent use.
+type Cache[K comparable, V any] struct {
+	mu       sync.Mutex
+	hash     func(K) uint64
+	levels   [][]cacheSlot[K, V] // each level holds numBuckets*b slots
+	b        int
+	size     int
+	capacity int
+	hand     int // clock hand, an offset into a key's candidate slots
+	sweep    int // global clock hand, see evictAny
+	stats    CacheStats
+}
+
+// CacheStats counts cache lookups and evictions.
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+type cacheSlot[K comparable, V any] struct {
+	key   K
+	val   V
+	state uint8 // cacheEmpty, cacheUsed or cacheTombstone
+	ref   bool  // CLOCK reference bit
+}
+
+// Slot states, playing the part of EMPTY and TOMBSTONE in the int tables.
+const (
+	cacheEmpty uint8 = iota
+	cacheUsed
+	cacheTombstone
+)
+
+// cacheDelta is the fraction of slots a Cache keeps free so that keys rarely
+// find all their candidate buckets full before the cache is at capacity.
+const cacheDelta = 0.1
+
+// NewCache creates a cache holding up to capacity entries, in buckets of b
+// slots laid out like a FunnelHashTable. hash must map equal keys to equal
+// values and spread distinct keys over all 64 bits. It panics where
+// TryNewCache returns an error.
+func NewCache[K comparable, V any](capacity int, b int, hash func(K) uint64) *Cache[K, V] {
+	c, err := TryNewCache[K, V](capacity, b, hash)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// TryNewCache is NewCache returning an error instead of panicking, see
+// TryNewElasticHashTable.
+func TryNewCache[K comparable, V any](capacity int, b int, hash func(K) uint64) (*Cache[K, V], error) {
+	if capacity < 1 || b < 1 {
+		return nil, invalidParams(KindFunnel, "cache capacity and bucket size must be positive")
+	}
+	buckets, _ := funnelLayout(slotsFor(capacity, cacheDelta), b, cacheDelta)
+	c := &Cache[K, V]{
+		hash:     hash,
+		levels:   make([][]cacheSlot[K, V], len(buckets)),
+		b:        b,
+		capacity: capacity,
+	}
+	for i, numB := range buckets {
+		c.levels[i] = make([]cacheSlot[K, V], numB*b)
+	}
+	return c, nil
+}
+
+// bucket returns the first slot of key's bucket in level i. Each level mixes
+// the hash with its own constant, so keys sharing a bucket in one level are
+// spread over the next.
+func (c *Cache[K, V]) bucket(h uint64, i int) int {
+	h ^= uint64(i+1) * 0x9E3779B97F4A7C15
+	h = (h ^ (h >> 30)) * 0xBF58476D1CE4E5B9
+	h ^= h >> 31
+	numB := uint64(len(c.levels[i]) / c.b)
+	hi, _ := bits.Mul64(h, numB)
+	return int(hi) * c.b
+}
+
+// lookup returns the slot holding key, or nil.
+func (c *Cache[K, V]) lookup(key K, h uint64) *cacheSlot[K, V] {
+	for i := range c.levels {
+		start := c.bucket(h, i)
+		for j := start; j < start+c.b; j++ {
+			s := &c.levels[i][j]
+			if s.state == cacheEmpty {
+				return nil // the key would have been placed here
+			}
+			if s.state == cacheUsed && s.key == key {
+				return s
+			}
+		}
+	}
+	return nil
+}
+
+// Get returns the value stored for key and marks the entry as recently used.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s := c.lookup(key, c.hash(key)); s != nil {
+		s.ref = true
+		c.stats.Hits++
+		return s.val, true
+	}
+	c.stats.Misses++
+	var zero V
+	return zero, false
+}
+
+// Put stores val for key. When the cache is full, or every slot key may use
+// is taken, an entry is evicted to make room.
+func (c *Cache[K, V]) Put(key K, val V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h := c.hash(key)
+	if s := c.lookup(key, h); s != nil {
+		s.val = val
+		s.ref = true
+		return
+	}
+
+	// Gather the candidate slots in probe order. Lookups stop at the first
+	// empty slot, so the key may not go past it.
+	var cand [64]*cacheSlot[K, V]
+	slots := cand[:0]
+	free := -1
+walk:
+	for i := range c.levels {
+		start := c.bucket(h, i)
+		for j := start; j < start+c.b; j++ {
+			s := &c.levels[i][j]
+			if s.state != cacheUsed && free < 0 {
+				free = len(slots)
+			}
+			if s.state == cacheEmpty {
+				break walk
+			}
+			slots = append(slots, s)
+		}
+	}
+	entry := cacheSlot[K, V]{key: key, val: val, state: cacheUsed}
+
+	if c.size < c.capacity && free >= 0 {
+		// Room left: first free slot, like FunnelHashTable.Insert
+		c.place(free, slots, h, entry)
+		c.size++
+		return
+	}
+
+	// Run the clock over the occupied candidates, starting at the hand
+	if n := len(slots); n > 0 {
+		for k := 0; k < 2*n; k++ {
+			idx := (c.hand + k) % n
+			s := slots[idx]
+			if s.state != cacheUsed {
+				continue
+			}
+			if s.ref {
+				s.ref = false
+				continue
+			}
+			c.hand = idx + 1
+			*s = entry
+			c.stats.Evictions++
+			return
+		}
+	}
+
+	// No occupied candidate: take the free slot and evict elsewhere
+	c.evictAny()
+	c.place(free, slots, h, entry)
+	c.size++
+}
+
+// place stores entry in candidate slot idx, which is slots[idx] or, when idx
+// is len(slots), the empty slot that ended the candidate walk.
+func (c *Cache[K, V]) place(idx int, slots []*cacheSlot[K, V], h uint64, entry cacheSlot[K, V]) {
+	if idx < len(slots) {
+		*slots[idx] = entry
+		return
+	}
+	i := idx / c.b
+	c.levels[i][c.bucket(h, i)+idx%c.b] = entry
+}
+
+// evictAny evicts one entry anywhere in the cache, sweeping a global clock
+// hand over all slots.
+func (c *Cache[K, V]) evictAny() {
+	total := 0
+	for _, level := range c.levels {
+		total += len(level)
+	}
+	for k := 0; k < 2*total; k++ {
+		idx := c.sweep
+		if c.sweep++; c.sweep == total {
+			c.sweep = 0
+		}
+		i := 0
+		for idx >= len(c.levels[i]) {
+			idx -= len(c.levels[i])
+			i++
+		}
+		s := &c.levels[i][idx]
+		if s.state != cacheUsed {
+			continue
+		}
+		if s.ref {
+			s.ref = false
+			continue
+		}
+		*s = cacheSlot[K, V]{state: cacheTombstone}
+		c.size--
+		c.stats.Evictions++
+		return
+	}
+}
+
+// Delete removes key and reports whether it was cached.
+func (c *Cache[K, V]) Delete(key K) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.lookup(key, c.hash(key))
+	if s == nil {
+		return false
+	}
+	*s = cacheSlot[K, V]{state: cacheTombstone}
+	c.size--
+	return true
+}
+
+// Len returns the number of cached entries.
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// Capacity returns the number of entries at which Put starts evicting.
+func (c *Cache[K, V]) Capacity() int {
+	return c.capacity
+}
+
+// Stats returns the hit, miss and eviction counters.
+func (c *Cache[K, V]) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
@@ -0,0 +1,71 @@
+package elastichash
+
+import (
+	"strconv"
+	"testing"
+)
+
+func intHash(k int) uint64 {
+	x := uint64(k) + 0x9E3779B97F4A7C15
+	x = (x ^ (x >> 30)) * 0xBF58476D1CE4E5B9
+	x = (x ^ (x >> 27)) * 0x94D049BB133111EB
+	return x ^ (x >> 31)
+}
+
+func TestCache(t *testing.T) {
+	c := NewCache[int, string](100, 4, intHash)
+
+	for i := 0; i < 50; i++ {
+		c.Put(i, strconv.Itoa(i))
+	}
+	if c.Len() != 50 {
+		t.Errorf("Expected 50 entries, got %d", c.Len())
+	}
+	if v, ok := c.Get(7); !ok || v != "7" {
+		t.Errorf("Get(7) = %q, %v", v, ok)
+	}
+	c.Put(7, "seven")
+	if v, _ := c.Get(7); v != "seven" {
+		t.Errorf("Put should replace the value, got %q", v)
+	}
+	if _, ok := c.Get(500); ok {
+		t.Errorf("Get of an absent key should miss")
+	}
+	if !c.Delete(7) || c.Delete(7) || c.Len() != 49 {
+		t.Errorf("Delete failed, Len %d", c.Len())
+	}
+	if st := c.Stats(); st.Hits != 2 || st.Misses != 1 || st.Evictions != 0 {
+		t.Errorf("Unexpected stats %+v", st)
+	}
+
+	// Past capacity entries are evicted instead of Put failing, and
+	// entries that keep being read survive the churn
+	hot := []int{1, 2, 3, 4, 5, 6, 8, 9, 10, 11}
+	for i := 1000; i < 5000; i++ {
+		for _, k := range hot {
+			c.Get(k)
+		}
+		c.Put(i, strconv.Itoa(i))
+		if c.Len() > c.Capacity() {
+			t.Fatalf("Len %d exceeds capacity %d", c.Len(), c.Capacity())
+		}
+		if v, ok := c.Get(i); !ok || v != strconv.Itoa(i) {
+			t.Fatalf("Just stored key %d not found", i)
+		}
+	}
+	if c.Len() != c.Capacity() {
+		t.Errorf("Expected a full cache, Len %d of %d", c.Len(), c.Capacity())
+	}
+	survivors := 0
+	for _, k := range hot {
+		if _, ok := c.Get(k); ok {
+			survivors++
+		}
+	}
+	if survivors < len(hot)-2 {
+		t.Errorf("Only %d of %d frequently read entries survived", survivors, len(hot))
+	}
+	if st := c.Stats(); st.Evictions < 4000-51 {
+		t.Errorf("Expected evictions for every Put past capacity, got %d", st.Evictions)
+	}
+}
@@ -0,0 +1,250 @@
+package elastichash
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// ConcurrentTable is a table for read-mostly workloads. Readers never take a
+// lock: Contains and Range read slots with atomic loads. Writers serialize
+// through a mutex and publish each slot with an atomic store, so a reader
+// sees a slot either before or after a write, never torn.
+//
+// When the table fills up, Insert builds a table twice the size off to the
+// side and swaps it in with an atomic pointer store. Readers still walking
+// the old table finish on it safely; it is never written again.
+type ConcurrentTable struct {
+	mu     sync.Mutex // serializes writers
+	cur    atomic.Pointer[rcuState]
+	create func(N int) slotTable
+}
+
+type rcuState struct {
+	t slotTable
+	n int // N passed to create
+}
+
+// NewConcurrentElasticTable creates a ConcurrentTable backed by
+// NewElasticHashTable(N, delta).
+func NewConcurrentElasticTable(N int, delta float64) *ConcurrentTable {
+	return newConcurrentTable(N, func(n int) slotTable { return NewElasticHashTable(n, delta) })
+}
+
+// NewConcurrentFunnelTable creates a ConcurrentTable backed by
+// NewFunnelHashTable(N, b, delta).
+func NewConcurrentFunnelTable(N int, b int, delta float64) *ConcurrentTable {
+	return newConcurrentTable(N, func(n int) slotTable { return NewFunnelHashTable(n, b, delta) })
+}
+
+func newConcurrentTable(N int, create func(n int) slotTable) *ConcurrentTable {
+	ct := &ConcurrentTable{create: create}
+	ct.cur.Store(&rcuState{t: create(N), n: N})
+	return ct
+}
+
+// loadSlot and storeSlot access a slot atomically. The size check is a
+// constant, so only one branch is compiled.
+func loadSlot(p *int) int {
+	if strconv.IntSize == 64 {
+		return int(atomic.LoadInt64((*int64)(unsafe.Pointer(p))))
+	}
+	return int(atomic.LoadInt32((*int32)(unsafe.Pointer(p))))
+}
+
+func storeSlot(p *int, v int) {
+	if strconv.IntSize == 64 {
+		atomic.StoreInt64((*int64)(unsafe.Pointer(p)), int64(v))
+	} else {
+		atomic.StoreInt32((*int32)(unsafe.Pointer(p)), int32(v))
+	}
+}
+
+// Contains reports whether key is present, without locking.
+func (ct *ConcurrentTable) Contains(key int) bool {
+	switch t := ct.cur.Load().t.(type) {
+	case *ElasticHashTable:
+		return t.containsAtomic(key)
+	case *FunnelHashTable:
+		return t.containsAtomic(key)
+	}
+	return false
+}
+
+// Insert adds key, growing the table if it is full.
+func (ct *ConcurrentTable) Insert(key int) error {
+	_, err := ct.Add(key)
+	return err
+}
+
+// Add inserts key, growing the table if it is full, and reports whether it
+// was newly added.
+func (ct *ConcurrentTable) Add(key int) (added bool, err error) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	st := ct.cur.Load()
+	if key == EMPTY || key == TOMBSTONE {
+		return false, st.t.fail(ErrInvalidKey, -1)
+	}
+	ref, found := st.t.find(key)
+	if found {
+		return false, nil
+	}
+	if st.t.Size() >= st.t.Capacity() || ref.lvl < 0 {
+		if st, err = ct.grow(st, 2*st.n); err != nil {
+			return false, err
+		}
+		if ref, _ = st.t.find(key); ref.lvl < 0 {
+			return false, st.t.noSlot()
+		}
+	}
+	storeSlot(&st.t.segment(ref.lvl)[ref.pos], key)
+	st.t.addSize(1)
+	return true, nil
+}
+
+// Remove deletes key and reports whether it was present.
+func (ct *ConcurrentTable) Remove(key int) bool {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	t := ct.cur.Load().t
+	ref, found := t.find(key)
+	if !found {
+		return false
+	}
+	storeSlot(&t.segment(ref.lvl)[ref.pos], TOMBSTONE)
+	t.addSize(-1)
+	return true
+}
+
+// Resize rebuilds the table with N total slots and swaps it in; tombstones
+// are dropped on the way. If N leaves no room for the current keys, or a key
+// finds no slot in the new table, it returns the error and the table is left
+// as it was.
+func (ct *ConcurrentTable) Resize(N int) error {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	_, err := ct.grow(ct.cur.Load(), N)
+	return err
+}
+
+// grow copies the keys of st into a new table of N slots and publishes it.
+// Caller holds ct.mu, so no write can slip in between the copy and the swap.
+// On failure nothing is published.
+func (ct *ConcurrentTable) grow(st *rcuState, N int) (*rcuState, error) {
+	next := &rcuState{t: ct.create(N), n: N}
+	if st.t.Size() > next.t.Capacity() {
+		return nil, next.t.fail(fmt.Errorf("%w: resized table cannot hold the current keys", ErrFull), -1)
+	}
+	var err error
+	st.t.Range(func(key int) bool {
+		err = next.t.Insert(key)
+		return err == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	ct.cur.Store(next)
+	return next, nil
+}
+
+// Size returns the number of keys.
+func (ct *ConcurrentTable) Size() int {
+	return ct.cur.Load().t.Size()
+}
+
+// Capacity returns the number of keys the current table holds before the
+// next Insert grows it.
+func (ct *ConcurrentTable) Capacity() int {
+	return ct.cur.Load().t.Capacity()
+}
+
+// Range calls fn for every key until fn returns false, without locking.
+// Keys inserted or removed meanwhile may or may not be visited.
+func (ct *ConcurrentTable) Range(fn func(key int) bool) {
+	t := ct.cur.Load().t
+	for i := 0; i < t.numSegments(); i++ {
+		seg := t.segment(i)
+		for pos := range seg {
+			v := loadSlot(&seg[pos])
+			if v == EMPTY || v == TOMBSTONE {
+				continue
+			}
+			if !fn(v) {
+				return
+			}
+		}
+	}
+}
+
+// containsAtomic is Contains with atomic slot loads, for ConcurrentTable.
+func (ht *ElasticHashTable) containsAtomic(key int) bool {
+	for i := 0; i < ht.L-1; i++ {
+		level := ht.levels[i]
+		m := len(level)
+		seq := ht.probes(key, i, m)
+		for attempt := 0; attempt < ht.R; attempt++ {
+			pos := seq.at(attempt)
+			if !seq.fresh(pos) {
+				continue
+			}
+			switch loadSlot(&level[pos]) {
+			case key:
+				return true
+			case EMPTY:
+				return false
+			}
+		}
+	}
+
+	level := ht.levels[ht.L-1]
+	m := len(level)
+	pos := ht.hashFunc(key, ht.L-1, 0, m)
+	for n, end := 0, scanBudget(ht.scanLimit, m); n < end; n++ {
+		switch loadSlot(&level[pos]) {
+		case key:
+			return true
+		case EMPTY:
+			return false
+		}
+		if pos++; pos == m {
+			pos = 0
+		}
+	}
+	return false
+}
+
+// containsAtomic is Contains with atomic slot loads, for ConcurrentTable.
+func (ht *FunnelHashTable) containsAtomic(key int) bool {
+	b := ht.b
+	h := mixKey(key)
+	for i := 0; i < len(ht.levels); i++ {
+		slots := ht.levels[i].slots
+		start := ht.bucket(h, i) * ht.stride
+		for j := start; j < start+b; j++ {
+			switch loadSlot(&slots[j]) {
+			case key:
+				return true
+			case EMPTY:
+				return false
+			}
+		}
+	}
+
+	m := len(ht.special)
+	pos := ht.specialStart(key)
+	for n, end := 0, scanBudget(ht.scanLimit, m); n < end; n++ {
+		switch loadSlot(&ht.special[pos]) {
+		case key:
+			return true
+		case EMPTY:
+			return false
+		}
+		if pos++; pos == m {
+			pos = 0
+		}
+	}
+	return false
+}
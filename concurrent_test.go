@@ -0,0 +1,102 @@
+package elastichash
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestConcurrentTable(t *testing.T) {
+	forEachTable(t, NewConcurrentElasticTable(1000, 0.1), NewConcurrentFunnelTable(1000, 8, 0.1), func(t *testing.T, ct *ConcurrentTable) {
+		for i := 0; i < 500; i++ {
+			ct.Insert(i)
+		}
+
+		// Readers check keys that are never removed while a writer
+		// churns other keys and forces several resizes
+		var stop atomic.Bool
+		var wg sync.WaitGroup
+		for r := 0; r < 4; r++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for !stop.Load() {
+					for i := 0; i < 500; i++ {
+						if !ct.Contains(i) {
+							t.Errorf("Stable key %d not visible to a reader", i)
+							return
+						}
+					}
+					runtime.Gosched()
+				}
+			}()
+		}
+		for i := 500; i < 10000; i++ {
+			if err := ct.Insert(i); err != nil {
+				t.Errorf("Insert(%d): %v", i, err)
+			}
+			if i%3 == 0 {
+				ct.Remove(i)
+			}
+		}
+		stop.Store(true)
+		wg.Wait()
+
+		if ct.Capacity() < 6000 {
+			t.Errorf("Expected the table to grow, capacity is %d", ct.Capacity())
+		}
+		want := 500
+		for i := 500; i < 10000; i++ {
+			if i%3 != 0 {
+				want++
+			}
+			if ct.Contains(i) != (i%3 != 0) {
+				t.Fatalf("Contains(%d) wrong after churn", i)
+			}
+		}
+		if ct.Size() != want {
+			t.Errorf("Expected size %d, got %d", want, ct.Size())
+		}
+
+		if err := ct.Resize(want / 2); !errors.Is(err, ErrFull) {
+			t.Errorf("Resize below the key count: expected ErrFull, got %v", err)
+		}
+		if ct.Size() != want || !ct.Contains(502) {
+			t.Errorf("Failed Resize changed the table")
+		}
+		if err := ct.Resize(want * 2); err != nil {
+			t.Fatalf("Resize: %v", err)
+		}
+		n := 0
+		ct.Range(func(int) bool { n++; return true })
+		if n != want || ct.Size() != want {
+			t.Errorf("Resize lost keys: Range saw %d, Size %d, expected %d", n, ct.Size(), want)
+		}
+	})
+}
+
+func BenchmarkConcurrentContains(b *testing.B) {
+	for _, tc := range []struct {
+		name string
+		t    Table
+	}{
+		{"LockFree", NewConcurrentElasticTable(1<<20, 0.1)},
+		{"Sharded", NewShardedElasticTable(6, 1<<20, 0.1)},
+	} {
+		n := tc.t.Capacity() / 2
+		for i := 0; i < n; i++ {
+			tc.t.Insert(i)
+		}
+		b.Run(tc.name, func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					tc.t.Contains(i % n)
+					i += 7919
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package elastichash
+
+// lookupGroup is the number of keys ContainsBatch keeps in flight. Each
+// stage issues one independent load per key of the group before any of them
+// is used, so the CPU overlaps up to that many cache misses instead of
+// waiting for each in turn.
+const lookupGroup = 16
+
+func checkBatchOut(kind Kind, keys []int, out []bool) {
+	if len(out) < len(keys) {
+		panic(invalidParams(kind, "ContainsBatch needs len(out) >= len(keys)"))
+	}
+}
+
+// ContainsBatch sets out[i] to Contains(keys[i]) for every key. Keys are
+// processed in groups: the last-level start of every key of a group is
+// hashed and its first slot loaded up front, then each key is resolved, so
+// the cache misses of a group overlap. The non-final levels are probed key by
+// key, as in Contains. For tables much larger than the CPU cache this is
+// about 1.4 times faster than calling Contains in a loop; for tables that fit
+// in cache it is slightly slower. out must be at least as long as keys.
+func (ht *ElasticHashTable) ContainsBatch(keys []int, out []bool) {
+	checkBatchOut(KindElastic, keys, out)
+	last := ht.levels[ht.L-1]
+	m := len(last)
+	limit := scanBudget(ht.scanLimit, m)
+	var (
+		pending [lookupGroup]int // indices into keys still unresolved
+		start   [lookupGroup]int
+		first   [lookupGroup]int
+	)
+	for base := 0; base < len(keys); base += lookupGroup {
+		end := base + lookupGroup
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		// The non-final levels are a few slots each and stay cached, so they
+		// are probed right away
+		n := 0
+		for k := base; k < end; k++ {
+			out[k] = false
+			if ht.filter != nil && !ht.filter.mayContain(keys[k]) {
+				continue
+			}
+			if found, stop := ht.probeUpper(keys[k]); found || stop {
+				out[k] = found
+				continue
+			}
+			pending[n] = k
+			n++
+		}
+
+		// Last level: issue every load, then scan
+		for p := 0; p < n; p++ {
+			start[p] = ht.hashFunc(keys[pending[p]], ht.L-1, 0, m)
+			first[p] = last[start[p]]
+		}
+		for p := 0; p < n; p++ {
+			key := keys[pending[p]]
+			if first[p] == key {
+				out[pending[p]] = true
+				continue
+			}
+			if first[p] == EMPTY {
+				continue
+			}
+			pos := start[p]
+			for offset := 1; offset < limit; offset++ {
+				if pos++; pos == m {
+					pos = 0
+				}
+				if last[pos] == key {
+					out[pending[p]] = true
+					break
+				}
+				if last[pos] == EMPTY {
+					break
+				}
+			}
+		}
+	}
+}
+
+// probeUpper walks the probe sequence of key in the non-final levels. It
+// reports whether key was found there, and whether the walk hit an EMPTY slot
+// so that key cannot be in the last level either (see find).
+func (ht *ElasticHashTable) probeUpper(key int) (found, stop bool) {
+	for i := 0; i < ht.L-1; i++ {
+		level := ht.levels[i]
+		m := len(level)
+		seq := ht.probes(key, i, m)
+		for attempt := 0; attempt < ht.R; attempt++ {
+			pos := seq.at(attempt)
+			if !seq.fresh(pos) {
+				continue
+			}
+			switch level[pos] {
+			case key:
+				return true, true
+			case EMPTY:
+				return false, true
+			}
+		}
+	}
+	return false, false
+}
+
+// ContainsBatch sets out[i] to Contains(keys[i]) for every key, see
+// ElasticHashTable.ContainsBatch. Keys move through the levels as a group:
+// for each level the bucket of every unresolved key is located and its first
+// slot loaded before any bucket is scanned, which roughly doubles throughput
+// on tables larger than the CPU cache. out must be at least as long as keys.
+func (ht *FunnelHashTable) ContainsBatch(keys []int, out []bool) {
+	checkBatchOut(KindFunnel, keys, out)
+	b := ht.b
+	var (
+		pending [lookupGroup]int // indices into keys still unresolved
+		hash    [lookupGroup]uint32
+		start   [lookupGroup]int
+		first   [lookupGroup]int
+	)
+	for base := 0; base < len(keys); base += lookupGroup {
+		end := base + lookupGroup
+		if end > len(keys) {
+			end = len(keys)
+		}
+		n := 0
+		for k := base; k < end; k++ {
+			out[k] = false
+			if ht.filter != nil && !ht.filter.mayContain(keys[k]) {
+				continue
+			}
+			pending[n] = k
+			hash[n] = mixKey(keys[k])
+			n++
+		}
+
+		for i := 0; i < len(ht.levels) && n > 0; i++ {
+			slots := ht.levels[i].slots
+			for p := 0; p < n; p++ {
+				start[p] = ht.bucket(hash[p], i) * ht.stride
+				first[p] = slots[start[p]]
+			}
+			// Keys found, or stopped by an EMPTY slot, are done; the others
+			// are compacted to the front and go on to the next level
+			kept := 0
+		scan:
+			for p := 0; p < n; p++ {
+				k, key := pending[p], keys[pending[p]]
+				if first[p] == key {
+					out[k] = true
+					continue
+				}
+				if first[p] == EMPTY {
+					continue
+				}
+				for j := start[p] + 1; j < start[p]+b; j++ {
+					if slots[j] == key {
+						out[k] = true
+						continue scan
+					}
+					if slots[j] == EMPTY {
+						continue scan
+					}
+				}
+				pending[kept], hash[kept] = k, hash[p]
+				kept++
+			}
+			n = kept
+		}
+
+		// Special array
+		m := len(ht.special)
+		limit := scanBudget(ht.scanLimit, m)
+		for p := 0; p < n; p++ {
+			start[p] = ht.specialStart(keys[pending[p]])
+			first[p] = ht.special[start[p]]
+		}
+		for p := 0; p < n; p++ {
+			key := keys[pending[p]]
+			if first[p] == key {
+				out[pending[p]] = true
+				continue
+			}
+			if first[p] == EMPTY {
+				continue
+			}
+			pos := start[p]
+			for offset := 1; offset < limit; offset++ {
+				if pos++; pos == m {
+					pos = 0
+				}
+				if ht.special[pos] == key {
+					out[pending[p]] = true
+					break
+				}
+				if ht.special[pos] == EMPTY {
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package elastichash
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestContainsBatch(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		ht   testTable
+	}{
+		{"Elastic", NewElasticHashTable(5000, 0.1)},
+		{"ElasticPermuted", NewElasticHashTableWithOptions(5000, 0.1, ElasticOptions{Permuted: true})},
+		{"Funnel", NewFunnelHashTable(5000, 4, 0.1)},
+		{"Funnel8", NewFunnelHashTable(5000, 8, 0.1)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ht := tc.ht
+			rng := rand.New(rand.NewSource(1))
+			for ht.Size() < ht.Capacity() {
+				ht.Insert(rng.Intn(20000))
+			}
+			// Tombstones must not end a lookup
+			for k := 0; k < 20000; k += 7 {
+				ht.Remove(k)
+			}
+
+			// A length that is not a multiple of the group size
+			keys := make([]int, 1001)
+			for i := range keys {
+				keys[i] = rng.Intn(25000)
+			}
+			out := make([]bool, len(keys))
+			for i := range out {
+				out[i] = true // stale results must be overwritten
+			}
+			ht.ContainsBatch(keys, out)
+			for i, k := range keys {
+				if out[i] != ht.Contains(k) {
+					t.Fatalf("ContainsBatch(%d) = %v, Contains says %v", k, out[i], !out[i])
+				}
+			}
+		})
+	}
+}
+
+func TestContainsBatchPrefilter(t *testing.T) {
+	ht := NewFunnelHashTable(1000, 4, 0.1)
+	for k := 0; k < 500; k++ {
+		ht.Insert(k)
+	}
+	ht.EnablePrefilter(0)
+	keys := []int{1, 499, 500, 10000}
+	out := make([]bool, len(keys))
+	ht.ContainsBatch(keys, out)
+	if !out[0] || !out[1] || out[2] || out[3] {
+		t.Errorf("Unexpected results %v", out)
+	}
+
+	defer func() {
+		if err, _ := recover().(error); !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("Short output: expected an ErrInvalidParams panic, got %v", err)
+		}
+	}()
+	ht.ContainsBatch(keys, out[:2])
+}
+
+// BenchmarkContainsBatch compares ContainsBatch with a Contains loop for hit
+// lookups in random order, reported per key. The large size is 256 MiB of
+// slots, beyond the last-level cache of most CPUs, where nearly every lookup
+// misses the cache.
+func BenchmarkContainsBatch(b *testing.B) {
+	for _, N := range []int{1 << 16, 1 << 25} {
+		if N > 1<<20 && testing.Short() {
+			continue
+		}
+		keys := make([]int, int(0.9*float64(N)))
+		for i := range keys {
+			keys[i] = i * 3
+		}
+		eht, err := NewElasticHashTableFrom(keys, 0.1)
+		if err != nil {
+			b.Fatal(err)
+		}
+		fht, err := NewFunnelHashTableFrom(keys, 4, 0.1)
+		if err != nil {
+			b.Fatal(err)
+		}
+		rng := rand.New(rand.NewSource(1))
+		query := make([]int, 1<<20)
+		for i := range query {
+			query[i] = keys[rng.Intn(len(keys))]
+		}
+		out := make([]bool, len(query))
+
+		for _, tc := range []struct {
+			name string
+			ht   testTable
+		}{
+			{"Elastic", eht},
+			{"Funnel", fht},
+		} {
+			b.Run(fmt.Sprintf("%s/N=%d/Loop", tc.name, N), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					q := query[i%len(query)]
+					out[0] = tc.ht.Contains(q)
+				}
+			})
+			b.Run(fmt.Sprintf("%s/N=%d/Batch", tc.name, N), func(b *testing.B) {
+				for done := 0; done < b.N; {
+					n := min(len(query), b.N-done)
+					tc.ht.ContainsBatch(query[:n], out)
+					done += n
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package elastichash
+
+// CountingTable is a multiset of integers: it stores a count alongside each
+// key. Insert increments the count, Remove decrements it and only tombstones
+// the key once the count drops to zero, so keys keep the slots and probe
+// sequences of the underlying ElasticHashTable or FunnelHashTable.
+type CountingTable struct {
+	t      slotTable
+	counts [][]uint32 // parallel to the table segments
+	total  int        // sum of all counts
+}
+
+// NewCountingElasticTable creates a CountingTable laid out like
+// NewElasticHashTable(N, delta).
+func NewCountingElasticTable(N int, delta float64) *CountingTable {
+	return newCountingTable(NewElasticHashTable(N, delta))
+}
+
+// NewCountingFunnelTable creates a CountingTable laid out like
+// NewFunnelHashTable(N, b, delta).
+func NewCountingFunnelTable(N int, b int, delta float64) *CountingTable {
+	return newCountingTable(NewFunnelHashTable(N, b, delta))
+}
+
+func newCountingTable(t slotTable) *CountingTable {
+	ct := &CountingTable{t: t, counts: make([][]uint32, t.numSegments())}
+	for i := range ct.counts {
+		ct.counts[i] = make([]uint32, len(t.segment(i)))
+	}
+	return ct
+}
+
+// Insert adds one occurrence of key. A new key needs a free slot and fails
+// once Size reaches Capacity; further occurrences of a present key only
+// increment its count.
+func (ct *CountingTable) Insert(key int) error {
+	if key == EMPTY || key == TOMBSTONE {
+		return ct.t.fail(ErrInvalidKey, -1)
+	}
+	ref, found := ct.t.find(key)
+	if found {
+		if ct.counts[ref.lvl][ref.pos] == ^uint32(0) {
+			return ct.t.fail(ErrCountOverflow, -1)
+		}
+		ct.counts[ref.lvl][ref.pos]++
+		ct.total++
+		return nil
+	}
+	if ct.t.Size() >= ct.t.Capacity() {
+		return ct.t.fail(ErrFull, -1)
+	}
+	if ref.lvl < 0 {
+		return ct.t.noSlot()
+	}
+	ct.t.own(ref.lvl)
+	ct.t.segment(ref.lvl)[ref.pos] = key
+	ct.t.addSize(1)
+	ct.counts[ref.lvl][ref.pos] = 1
+	ct.total++
+	return nil
+}
+
+// Remove deletes one occurrence of key and reports whether key was present.
+func (ct *CountingTable) Remove(key int) bool {
+	ref, found := ct.t.find(key)
+	if !found {
+		return false
+	}
+	ct.total--
+	if ct.counts[ref.lvl][ref.pos]--; ct.counts[ref.lvl][ref.pos] == 0 {
+		ct.t.own(ref.lvl)
+		ct.t.segment(ref.lvl)[ref.pos] = TOMBSTONE
+		ct.t.addSize(-1)
+	}
+	return true
+}
+
+// Count returns the number of occurrences of key, zero if it is absent.
+func (ct *CountingTable) Count(key int) int {
+	ref, found := ct.t.find(key)
+	if !found {
+		return 0
+	}
+	return int(ct.counts[ref.lvl][ref.pos])
+}
+
+// Contains reports whether key occurs at least once.
+func (ct *CountingTable) Contains(key int) bool {
+	return ct.t.Contains(key)
+}
+
+// Size returns the number of distinct keys.
+func (ct *CountingTable) Size() int {
+	return ct.t.Size()
+}
+
+// Total returns the number of occurrences of all keys together.
+func (ct *CountingTable) Total() int {
+	return ct.total
+}
+
+// Capacity returns the maximum number of distinct keys.
+func (ct *CountingTable) Capacity() int {
+	return ct.t.Capacity()
+}
+
+// Range calls fn for every distinct key until fn returns false.
+func (ct *CountingTable) Range(fn func(key int) bool) {
+	ct.t.Range(fn)
+}
+
+// RangeCounts calls fn for every distinct key with its count until fn
+// returns false.
+func (ct *CountingTable) RangeCounts(fn func(key, count int) bool) {
+	for i, counts := range ct.counts {
+		for pos, v := range ct.t.segment(i) {
+			if v != EMPTY && v != TOMBSTONE && !fn(v, int(counts[pos])) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package elastichash
+
+import "testing"
+
+func TestCountingTable(t *testing.T) {
+	forEachTable(t, NewCountingElasticTable(100, 0.25), NewCountingFunnelTable(100, 4, 0.25), func(t *testing.T, ct *CountingTable) {
+		for k := 0; k < 50; k++ {
+			for n := 0; n <= k%4; n++ {
+				if err := ct.Insert(k); err != nil {
+					t.Fatalf("Insert(%d): %v", k, err)
+				}
+			}
+		}
+		if ct.Size() != 50 {
+			t.Errorf("Expected 50 distinct keys, got %d", ct.Size())
+		}
+		total := 0
+		for k := 0; k < 50; k++ {
+			total += k%4 + 1
+			if ct.Count(k) != k%4+1 {
+				t.Errorf("Count(%d) = %d, expected %d", k, ct.Count(k), k%4+1)
+			}
+		}
+		if ct.Total() != total {
+			t.Errorf("Expected total %d, got %d", total, ct.Total())
+		}
+
+		// Decrements keep the key until its count reaches zero
+		ct.Remove(3) // count 4 -> 3
+		if ct.Count(3) != 3 || !ct.Contains(3) || ct.Size() != 50 {
+			t.Errorf("Key 3 should remain with count 3, got %d", ct.Count(3))
+		}
+		if !ct.Remove(4) || ct.Contains(4) || ct.Count(4) != 0 || ct.Size() != 49 {
+			t.Errorf("Key 4 with count 1 should be gone after one Remove")
+		}
+		if ct.Remove(4) || ct.Remove(1000) {
+			t.Errorf("Removing absent keys should report false")
+		}
+
+		// Counts follow keys through a tombstoned slot being reused
+		ct.Insert(4)
+		ct.Insert(4)
+		if ct.Count(4) != 2 || ct.Count(3) != 3 {
+			t.Errorf("Counts wrong after reinsertion: Count(4)=%d Count(3)=%d", ct.Count(4), ct.Count(3))
+		}
+
+		sum := 0
+		ct.RangeCounts(func(key, count int) bool {
+			if count != ct.Count(key) {
+				t.Errorf("RangeCounts reported %d for key %d, Count says %d", count, key, ct.Count(key))
+			}
+			sum += count
+			return true
+		})
+		if sum != ct.Total() {
+			t.Errorf("RangeCounts sum %d differs from Total %d", sum, ct.Total())
+		}
+
+		// Capacity limits distinct keys, not occurrences
+		for k := 100; ct.Size() < ct.Capacity(); k++ {
+			ct.Insert(k)
+		}
+		if ct.Insert(5000) == nil {
+			t.Errorf("Insert of a new key into a full table should fail")
+		}
+		if err := ct.Insert(0); err != nil || ct.Count(0) != 2 {
+			t.Errorf("Insert of a present key into a full table should count: %v", err)
+		}
+	})
+}
@@ -1,8 +1,8 @@
 package elastichash
 
 import (
-	"errors"
 	"fmt"
+	"math/bits"
 	"sync/atomic"
 )
 
@@ -16,17 +16,70 @@ type ElasticHashTable struct {
 	levels    [][]int  // segments A0 ... A_{L-1}
 	L         int      // number of levels
 	R         int      // max probes per level (threshold)
+	permuted  bool     // probe sequences are permutations of each level (see ElasticOptions)
 	size      int32    // current number of elements inserted (atomic)
 	capacity  int      // maximum allowed elements (respecting load factor)
+	delta     float64  // fraction of slots left empty, as passed to the constructor
+	readOnly  bool     // set for read-only memory-mapped tables
+	release   func() error // releases external memory backing levels (see Close)
+	offHeap   bool     // levels were allocated with ElasticOptions.OffHeap
+	shared    []bool   // levels still shared with a snapshot, nil if none was taken
+	filter    *bloomFilter // optional prefilter for Contains, see EnablePrefilter
+	filterShared bool  // filter still shared with a snapshot
+	index     *orderedIndex // optional ordered index for RangeKeys, see EnableOrderedIndex
+	probeLimit int     // max last-level slots an insertion scans, 0 for all (see SetProbeLimit)
+	scanLimit  int     // every last-level key lies this close to its start, 0 if unknown
+}
+
+// elasticLevels is the number of levels L of an elastic table.
+const elasticLevels = 4
+
+// ElasticOptions tunes an ElasticHashTable beyond its size and delta.
+type ElasticOptions struct {
+	// Probes is R, the number of probes per non-final level, which is also
+	// the size of those levels. Zero selects the default of 4.
+	Probes int
+	// Permuted makes the probe sequence of a key in each non-final level a
+	// permutation of that level (double hashing with a stride coprime with
+	// the level size), so every probe examines a fresh slot. By default the
+	// probes are independent hashes, which can repeat a position and waste
+	// the probe.
+	Permuted bool
+	// OffHeap places the slots in an anonymous memory mapping outside the
+	// Go heap, backed by huge pages on Linux where available, so that very
+	// large tables add nothing to garbage collection work. Call Close to
+	// release the mapping. On other platforms the slots stay on the heap.
+	OffHeap bool
 }
 
 // NewElasticHashTable creates a new ElasticHashTable with total array size N and fraction delta of slots left empty.
 func NewElasticHashTable(N int, delta float64) *ElasticHashTable {
+	return NewElasticHashTableWithOptions(N, delta, ElasticOptions{})
+}
+
+// NewElasticHashTableWithOptions creates an ElasticHashTable like
+// NewElasticHashTable, tuned by opts. It panics where TryNewElasticHashTable
+// returns an error.
+func NewElasticHashTableWithOptions(N int, delta float64, opts ElasticOptions) *ElasticHashTable {
+	table, err := TryNewElasticHashTable(N, delta, opts)
+	if err != nil {
+		panic(err)
+	}
+	return table
+}
+
+// TryNewElasticHashTable is NewElasticHashTableWithOptions for parameters
+// that come from input: it returns a *TableError, wrapping ErrInvalidParams
+// or the failed allocation of an off-heap table, instead of panicking.
+func TryNewElasticHashTable(N int, delta float64, opts ElasticOptions) (*ElasticHashTable, error) {
 	if delta < 0 || delta >= 1 {
-		panic("delta must be in (0,1)")
+		return nil, invalidParams(KindElastic, "delta must be in (0,1)")
+	}
+	if opts.Probes < 0 {
+		return nil, invalidParams(KindElastic, "probe count must not be negative")
 	}
 	// Determine number of levels L (we use a small constant or derive from log(1/delta)).
-	L := 4
+	L := elasticLevels
 	if L < 2 {
 		L = 2
 	}
@@ -35,40 +88,87 @@ func NewElasticHashTable(N int, delta float64) *ElasticHashTable {
 	table := &ElasticHashTable{
 		levels:   make([][]int, L),
 		L:        L,
-		R:        L,         // for simplicity, R = L (could be tuned independently)
+		R:        L,         // for simplicity, R = L unless set in opts
 		size:     0,
 		capacity: maxElems,
+		delta:    delta,
+	}
+	if opts.Probes > 0 {
+		table.R = opts.Probes
+	}
+	table.permuted = opts.Permuted
+	sizes := elasticLayout(N, L, table.R)
+	if opts.OffHeap {
+		levels, release, err := offHeapSlots(sizes)
+		if err != nil {
+			return nil, table.fail(err, -1)
+		}
+		table.levels, table.release, table.offHeap = levels, release, true
+		return table, nil
+	}
+	for i, n := range sizes {
+		table.levels[i] = make([]int, n)
+		for j := range table.levels[i] {
+			table.levels[i][j] = EMPTY
+		}
 	}
-	// Allocate levels. For simplicity, give first L-1 levels capacity = R (small constant),
+	return table, nil
+}
+
+// NewElasticForCapacity creates an ElasticHashTable whose Capacity is at
+// least n, leaving a delta fraction of its slots empty. It allocates the
+// smallest total size N that achieves this, about n/(1-delta) slots;
+// EstimateSize reports the exact N and memory beforehand.
+func NewElasticForCapacity(n int, delta float64) *ElasticHashTable {
+	if delta < 0 || delta >= 1 {
+		panic(invalidParams(KindElastic, "delta must be in (0,1)"))
+	}
+	if n < 0 {
+		panic(invalidParams(KindElastic, "element count must not be negative"))
+	}
+	return NewElasticHashTable(slotsFor(n, delta), delta)
+}
+
+// elasticLayout returns the sizes of the L levels of an elastic table of
+// total size N with R probes per non-final level.
+func elasticLayout(N, L, R int) []int {
+	// For simplicity, give first L-1 levels capacity = R (small constant),
 	// and last level gets the remainder.
+	sizes := make([]int, L)
 	for i := 0; i < L-1; i++ {
-		segSize := table.R  // small segment
+		segSize := R  // small segment
 		if segSize > N {
 			segSize = N
 		}
-		table.levels[i] = make([]int, segSize)
-		for j := range table.levels[i] {
-			table.levels[i][j] = EMPTY
+		if segSize < 1 {
+			segSize = 1 // tiny tables still need a slot per level
 		}
+		sizes[i] = segSize
 		N -= segSize
 	}
 	// Last level gets all remaining slots (at least 1).
 	if N < 1 {
 		N = 1
 	}
-	table.levels[L-1] = make([]int, N)
-	for j := range table.levels[L-1] {
-		table.levels[L-1][j] = EMPTY
-	}
-	return table
+	sizes[L-1] = N
+	return sizes
 }
 
 // hashFunc is a deterministic hash generator for (key, level, attempt) -> pseudo-random slot index.
 // This implementation uses SplitMix64 algorithm for fast high-quality hashing
 func (ht *ElasticHashTable) hashFunc(key, level, attempt, mod int) int {
-	// Combine key, level, attempt into a 64-bit state
-	x := uint64(key)
-	x ^= (uint64(level) << 33) | uint64(attempt)
+	return probeHash(probeSeed(key, level), attempt, mod)
+}
+
+// probeSeed combines key and level into the state that probeHash mixes with
+// the attempt number; a walk computes it once per level.
+func probeSeed(key, level int) uint64 {
+	return uint64(key) ^ uint64(level)<<33
+}
+
+// probeHash is hashFunc with the key and level already combined by probeSeed.
+func probeHash(seed uint64, attempt, mod int) int {
+	x := seed ^ uint64(attempt)
 	
 	// SplitMix64 mixing - extremely fast and high quality bit mixing
 	x += 0x9E3779B97F4A7C15  // Golden ratio constant
@@ -76,200 +176,247 @@ func (ht *ElasticHashTable) hashFunc(key, level, attempt, mod int) int {
 	x = (x ^ (x >> 27)) * 0x94D049BB133111EB
 	x = x ^ (x >> 31)
 	
-	// Return a non-negative int index
-	return int(x % uint64(mod))
+	// Map to [0, mod) with Lemire's multiply-shift reduction, which is as
+	// cheap for arbitrary sizes as masking is for powers of two
+	hi, _ := bits.Mul64(x, uint64(mod))
+	return int(hi)
+}
+
+// probeSeq generates the probe sequence of a key in one level, in the order
+// insertions try the slots: R hashed positions, or R steps of a permutation
+// of the level for a permuted table. Positions are computed one at a time as
+// a walk reaches them, and every walk of the upper levels goes through it so
+// that they all agree on the order:
+//
+//	seq := ht.probes(key, lvl, m)
+//	for attempt := 0; attempt < ht.R; attempt++ {
+//		pos := seq.at(attempt)
+//		if !seq.fresh(pos) {
+//			continue
+//		}
+//		...
+//	}
+//
+// It is kept to four fields so that the compiler holds it in registers.
+type probeSeq struct {
+	x    uint64 // probeSeed of key and level, or the start of a permutation
+	m    int    // level size
+	step int    // stride of a permutation, or 0 if hashed
+	seen uint64 // positions below 64 already probed
+}
+
+func (ht *ElasticHashTable) probes(key, lvl, m int) probeSeq {
+	seed := probeSeed(key, lvl)
+	if ht.permuted {
+		return permutation(seed, m)
+	}
+	return probeSeq{x: seed, m: m}
+}
+
+// permutation returns a sequence that steps through a level by double
+// hashing: a stride coprime with the level size visits every slot exactly
+// once, so each of the first m probes examines a fresh slot.
+func permutation(seed uint64, m int) probeSeq {
+	s := probeSeq{x: uint64(probeHash(seed, 0, m)), m: m, step: 1}
+	if m > 1 {
+		s.step = 1 + probeHash(seed, 1, m-1)
+		for gcd(s.step, m) != 1 {
+			s.step++ // terminates at m-1 at the latest
+		}
+	}
+	return s
+}
+
+// at returns the position of the given attempt.
+func (s *probeSeq) at(attempt int) int {
+	if s.step != 0 {
+		return (int(s.x) + attempt*s.step) % s.m
+	}
+	return probeHash(s.x, attempt, s.m)
+}
+
+// fresh reports whether pos, just returned by at, is probed for the first
+// time, so that a position produced twice is only examined once. Only
+// positions below 64 are tracked, which covers every upper level of up to 64
+// slots (all of them for R <= 64 with the default layout). A repeat past
+// that is examined again, which never changes the outcome since a walk does
+// not modify the slots it reads.
+func (s *probeSeq) fresh(pos int) bool {
+	if pos >= 64 {
+		return true
+	}
+	bit := uint64(1) << uint(pos)
+	seen := s.seen & bit
+	s.seen |= bit
+	return seen == 0
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
 }
 
 // Insert adds a key to the hash table. Returns an error if the table is at capacity.
+// A single walk of the probe sequence (see find) both detects a key that is
+// already present and yields the first free slot, so the table is traversed
+// once per insertion.
 func (ht *ElasticHashTable) Insert(key int) error {
+	_, err := ht.insert(key)
+	return err
+}
+
+// insert implements Insert and Add.
+func (ht *ElasticHashTable) insert(key int) (bool, error) {
+	if ht.readOnly {
+		return false, ht.fail(ErrReadOnly, -1)
+	}
+	if key == EMPTY || key == TOMBSTONE {
+		return false, ht.fail(ErrInvalidKey, -1)
+	}
+	ref, found := ht.find(key)
+	if found {
+		return false, nil // already in table, nothing to do
+	}
 	if atomic.LoadInt32(&ht.size) >= int32(ht.capacity) {
-		return errors.New("hash table is full (max load reached)")
+		return false, ht.fail(ErrFull, -1)
 	}
-	
-	// Check if key already exists in any level
-	if ht.Contains(key) {
-		return nil // already in table, nothing to do
+	if ref.lvl < 0 {
+		return false, ht.noSlot()
 	}
-	
-	// Try each level in order
+	ht.own(ref.lvl)
+	ht.levels[ref.lvl][ref.pos] = key
+	atomic.AddInt32(&ht.size, 1)
+	ht.addToFilter(key)
+	ht.indexAdd(key)
+	return true, nil
+}
+
+// slotRef addresses a slot by level and position. In FunnelHashTable the
+// special array is addressed as level len(levels).
+type slotRef struct {
+	lvl, pos int
+}
+
+// find walks the probe sequence of key once, in the order Insert uses it.
+// If key is present it returns its slot and true. Otherwise it returns the
+// first EMPTY or TOMBSTONE slot on the way, where Insert would place key, or
+// a slot with lvl -1 if there is none. The walk ends at the first EMPTY slot:
+// slots never become EMPTY again, so a key stored further along the sequence
+// would have been placed there instead.
+func (ht *ElasticHashTable) find(key int) (slotRef, bool) {
+	free := slotRef{lvl: -1}
 	for i := 0; i < ht.L-1; i++ {
-		m := len(ht.levels[i])
-		// Generate up to R probe positions in Ai
-		// Use a fixed-size array instead of map for tracking tried positions
-		var tried [16]bool // Assuming R <= 16; adjust size if needed
+		level := ht.levels[i]
+		m := len(level)
+		seq := ht.probes(key, i, m)
 		for attempt := 0; attempt < ht.R; attempt++ {
-			pos := ht.hashFunc(key, i, attempt, m)
-			if pos < len(tried) && tried[pos] {
-				continue // avoid duplicate probe (rare)
-			}
-			if pos < len(tried) {
-				tried[pos] = true
+			pos := seq.at(attempt)
+			if !seq.fresh(pos) {
+				continue
 			}
-			
-			// Found an empty or deleted slot
-			if ht.levels[i][pos] == EMPTY || ht.levels[i][pos] == TOMBSTONE {
-				ht.levels[i][pos] = key
-				atomic.AddInt32(&ht.size, 1)
-				return nil // inserted successfully
+			switch level[pos] {
+			case key:
+				return slotRef{i, pos}, true
+			case EMPTY:
+				if free.lvl < 0 {
+					free = slotRef{i, pos}
+				}
+				return free, false
+			case TOMBSTONE:
+				if free.lvl < 0 {
+					free = slotRef{i, pos}
+				}
 			}
 		}
-		// If we reach here, all R probes in A_i were occupied – move down to next level
 	}
-	
-	// Final level (A_{L-1}): optimize for power of 2 sizes when possible
+
+	// Last level: linear probing from the hashed start
 	lastLevel := ht.L - 1
-	m := len(ht.levels[lastLevel])
-	
-	// Check if m is a power of 2 for fast modulo with bitwise AND
-	isPowerOfTwo := (m & (m - 1)) == 0
-	
-	// Starting slot
-	start := ht.hashFunc(key, lastLevel, 0, m)
-	
-	if isPowerOfTwo {
-		// Fast path with bitwise AND for modulo
-		mask := m - 1
-		for offset := 0; offset < m; offset++ {
-			pos := (start + offset) & mask
-			if ht.levels[lastLevel][pos] == EMPTY || ht.levels[lastLevel][pos] == TOMBSTONE {
-				ht.levels[lastLevel][pos] = key
-				atomic.AddInt32(&ht.size, 1)
-				return nil
+	level := ht.levels[lastLevel]
+	m := len(level)
+	pos := ht.hashFunc(key, lastLevel, 0, m)
+	budget := scanBudget(ht.probeLimit, m)
+	for n, end := 0, scanBudget(ht.scanLimit, m); n < end; n++ {
+		switch level[pos] {
+		case key:
+			return slotRef{lastLevel, pos}, true
+		case EMPTY:
+			if free.lvl < 0 && n < budget {
+				free = slotRef{lastLevel, pos}
 			}
-		}
-	} else {
-		// Standard path with modulo
-		for offset := 0; offset < m; offset++ {
-			pos := (start + offset) % m
-			if ht.levels[lastLevel][pos] == EMPTY || ht.levels[lastLevel][pos] == TOMBSTONE {
-				ht.levels[lastLevel][pos] = key
-				atomic.AddInt32(&ht.size, 1)
-				return nil
+			return free, false
+		case TOMBSTONE:
+			if free.lvl < 0 && n < budget {
+				free = slotRef{lastLevel, pos}
 			}
 		}
+		if pos++; pos == m {
+			pos = 0
+		}
 	}
-	
-	return errors.New("no empty slot found in final level (this should not happen under expected conditions)")
+	return free, false
+}
+
+// segment returns the slots of level i.
+func (ht *ElasticHashTable) segment(i int) []int {
+	return ht.levels[i]
+}
+
+// numSegments returns the number of levels, for use with segment.
+func (ht *ElasticHashTable) numSegments() int {
+	return ht.L
+}
+
+// addSize adjusts the element count after slots were written directly.
+func (ht *ElasticHashTable) addSize(n int) {
+	atomic.AddInt32(&ht.size, int32(n))
 }
 
 // Contains checks if the key is in the table.
 func (ht *ElasticHashTable) Contains(key int) bool {
+	if ht.filter != nil && !ht.filter.mayContain(key) {
+		return false
+	}
 	// Search through the same probe sequence used in insertion.
 	for i := 0; i < ht.L-1; i++ {
-		m := len(ht.levels[i])
-		// Use a fixed-size array instead of map for tracking tried positions
-		var tried [16]bool // Assuming R <= 16; adjust size if needed
-		
-		// Unrolled loop for first few attempts for better performance
-		if ht.R >= 1 {
-			pos := ht.hashFunc(key, i, 0, m)
-			if pos < len(tried) {
-				tried[pos] = true
-				if ht.levels[i][pos] == key {
-					return true
-				}
-				if ht.levels[i][pos] == EMPTY {
-					goto nextLevel
-				}
-				// Tombstones require us to continue searching (unlike empty slots)
-			}
-		}
-		
-		if ht.R >= 2 {
-			pos := ht.hashFunc(key, i, 1, m)
-			if pos < len(tried) && !tried[pos] {
-				tried[pos] = true
-				if ht.levels[i][pos] == key {
-					return true
-				}
-				if ht.levels[i][pos] == EMPTY {
-					goto nextLevel
-				}
-			}
-		}
-		
-		if ht.R >= 3 {
-			pos := ht.hashFunc(key, i, 2, m)
-			if pos < len(tried) && !tried[pos] {
-				tried[pos] = true
-				if ht.levels[i][pos] == key {
-					return true
-				}
-				if ht.levels[i][pos] == EMPTY {
-					goto nextLevel
-				}
-			}
-		}
-		
-		if ht.R >= 4 {
-			pos := ht.hashFunc(key, i, 3, m)
-			if pos < len(tried) && !tried[pos] {
-				tried[pos] = true
-				if ht.levels[i][pos] == key {
-					return true
-				}
-				if ht.levels[i][pos] == EMPTY {
-					goto nextLevel
-				}
-			}
-		}
-		
-		// Check remaining attempts
-		for attempt := 4; attempt < ht.R; attempt++ {
-			pos := ht.hashFunc(key, i, attempt, m)
-			if pos < len(tried) && tried[pos] {
+		level := ht.levels[i]
+		m := len(level)
+		seq := ht.probes(key, i, m)
+		for attempt := 0; attempt < ht.R; attempt++ {
+			pos := seq.at(attempt)
+			if !seq.fresh(pos) {
 				continue
 			}
-			if pos < len(tried) {
-				tried[pos] = true
-			}
-			
-			if ht.levels[i][pos] == key {
+			if level[pos] == key {
 				return true
 			}
-			if ht.levels[i][pos] == EMPTY {
-				// If we hit an empty slot during search, we can stop looking in this level – 
-				// since insertion would have placed the key in the first empty encountered, 
-				// not finding it here means it was never in this level.
-				goto nextLevel
+			if level[pos] == EMPTY {
+				// Insertion would have placed the key in the first empty
+				// slot, so it was never stored past this one.
+				break
 			}
 			// Tombstones require us to continue searching
 		}
-		
-	nextLevel:
-		// not found in level i; continue to next level
 	}
 	
-	// Last level: optimize for power of 2 sizes
+	// Last level: linear probing, wrapping without a modulo
 	lastLevel := ht.L - 1
-	m := len(ht.levels[lastLevel])
-	isPowerOfTwo := (m & (m - 1)) == 0
-	start := ht.hashFunc(key, lastLevel, 0, m)
-	
-	if isPowerOfTwo {
-		// Fast path with bitwise AND
-		mask := m - 1
-		for offset := 0; offset < m; offset++ {
-			pos := (start + offset) & mask
-			if ht.levels[lastLevel][pos] == key {
-				return true
-			}
-			if ht.levels[lastLevel][pos] == EMPTY {
-				return false
-			}
-			// Continue on tombstones
+	level := ht.levels[lastLevel]
+	m := len(level)
+	pos := ht.hashFunc(key, lastLevel, 0, m)
+	limit := scanBudget(ht.scanLimit, m)
+	for offset := 0; offset < limit; offset++ {
+		if level[pos] == key {
+			return true
 		}
-	} else {
-		// Standard path
-		for offset := 0; offset < m; offset++ {
-			pos := (start + offset) % m
-			if ht.levels[lastLevel][pos] == key {
-				return true
-			}
-			if ht.levels[lastLevel][pos] == EMPTY {
-				return false
-			}
-			// Continue on tombstones
+		if level[pos] == EMPTY {
+			return false
+		}
+		// Continue on tombstones
+		if pos++; pos == m {
+			pos = 0
 		}
 	}
 	
@@ -279,24 +426,24 @@ func (ht *ElasticHashTable) Contains(key int) bool {
 // Remove deletes a key from the hash table if it exists.
 // Returns true if the key was found and removed, false otherwise.
 func (ht *ElasticHashTable) Remove(key int) bool {
+	if ht.readOnly {
+		return false
+	}
 	// Search through the same probe sequence used in insertion and Contains.
 	for i := 0; i < ht.L-1; i++ {
 		m := len(ht.levels[i])
-		var tried [16]bool // Assuming R <= 16
-		
+		seq := ht.probes(key, i, m)
 		for attempt := 0; attempt < ht.R; attempt++ {
-			pos := ht.hashFunc(key, i, attempt, m)
-			if pos < len(tried) && tried[pos] {
+			pos := seq.at(attempt)
+			if !seq.fresh(pos) {
 				continue
 			}
-			if pos < len(tried) {
-				tried[pos] = true
-			}
-			
 			if ht.levels[i][pos] == key {
 				// Found the key - mark as deleted
+				ht.own(i)
 				ht.levels[i][pos] = TOMBSTONE
 				atomic.AddInt32(&ht.size, -1)
+				ht.indexRemove(key)
 				return true
 			}
 			if ht.levels[i][pos] == EMPTY {
@@ -309,39 +456,39 @@ func (ht *ElasticHashTable) Remove(key int) bool {
 	// Last level
 	lastLevel := ht.L - 1
 	m := len(ht.levels[lastLevel])
-	isPowerOfTwo := (m & (m - 1)) == 0
-	start := ht.hashFunc(key, lastLevel, 0, m)
-	
-	if isPowerOfTwo {
-		mask := m - 1
-		for offset := 0; offset < m; offset++ {
-			pos := (start + offset) & mask
-			if ht.levels[lastLevel][pos] == key {
-				ht.levels[lastLevel][pos] = TOMBSTONE
-				atomic.AddInt32(&ht.size, -1)
-				return true
-			}
-			if ht.levels[lastLevel][pos] == EMPTY {
-				return false
-			}
+	pos := ht.hashFunc(key, lastLevel, 0, m)
+	limit := scanBudget(ht.scanLimit, m)
+	for offset := 0; offset < limit; offset++ {
+		if ht.levels[lastLevel][pos] == key {
+			ht.own(lastLevel)
+			ht.levels[lastLevel][pos] = TOMBSTONE
+			atomic.AddInt32(&ht.size, -1)
+			ht.indexRemove(key)
+			return true
 		}
-	} else {
-		for offset := 0; offset < m; offset++ {
-			pos := (start + offset) % m
-			if ht.levels[lastLevel][pos] == key {
-				ht.levels[lastLevel][pos] = TOMBSTONE
-				atomic.AddInt32(&ht.size, -1)
-				return true
-			}
-			if ht.levels[lastLevel][pos] == EMPTY {
-				return false
-			}
+		if ht.levels[lastLevel][pos] == EMPTY {
+			return false
+		}
+		if pos++; pos == m {
+			pos = 0
 		}
 	}
 	
 	return false
 }
 
+// Range calls fn for every key in the table, level by level, until fn
+// returns false. The table must not be modified during the iteration.
+func (ht *ElasticHashTable) Range(fn func(key int) bool) {
+	for _, level := range ht.levels {
+		for _, v := range level {
+			if v != EMPTY && v != TOMBSTONE && !fn(v) {
+				return
+			}
+		}
+	}
+}
+
 // Size returns the current number of elements in the table.
 func (ht *ElasticHashTable) Size() int {
 	return int(atomic.LoadInt32(&ht.size))
@@ -352,6 +499,23 @@ func (ht *ElasticHashTable) Capacity() int {
 	return ht.capacity
 }
 
+// Close releases memory backing the table when it was opened from a mapped
+// file or created with ElasticOptions.OffHeap. The table and its snapshots
+// must not be used afterwards. For regular tables it is a no-op.
+func (ht *ElasticHashTable) Close() error {
+	if ht.release == nil {
+		return nil
+	}
+	err := ht.release()
+	ht.release, ht.offHeap = nil, false
+	ht.levels = make([][]int, ht.L)
+	for i := range ht.levels {
+		ht.levels[i] = []int{EMPTY}
+	}
+	atomic.StoreInt32(&ht.size, 0)
+	return err
+}
+
 // String returns a debug representation of the hash table.
 func (ht *ElasticHashTable) String() string {
 	str := ""
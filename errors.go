@@ -0,0 +1,111 @@
+package elastichash
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned, wrapped in a *TableError, by the table operations. Test
+// for them with errors.Is.
+var (
+	// ErrFull means the table already holds Capacity keys.
+	ErrFull = errors.New("hash table is full")
+	// ErrNoSlot means every slot the key may use is taken, although the
+	// table is below capacity. This should not happen under expected
+	// conditions.
+	ErrNoSlot = errors.New("no empty slot found for key")
+	// ErrInvalidKey means the key equals the EMPTY or TOMBSTONE marker.
+	ErrInvalidKey = errors.New("key collides with the EMPTY or TOMBSTONE marker")
+	// ErrInvalidParams means a constructor was given unusable parameters.
+	// The New constructors panic with a *TableError wrapping it, as make
+	// does for a negative length, since sizes and deltas are normally
+	// constants of the program. Code that derives them from input uses the
+	// TryNew variants, which return the error instead, or checks them first
+	// with EstimateSize.
+	ErrInvalidParams = errors.New("invalid table parameters")
+	// ErrReadOnly means the table is a snapshot or a read-only mapping.
+	ErrReadOnly = errors.New("hash table is read-only")
+	// ErrProbeLimit means a probe limit is set (see
+	// ElasticHashTable.SetProbeLimit) and the linear scan of the final level
+	// or special array used up its budget without finding a free slot.
+	ErrProbeLimit = errors.New("probe limit reached before finding a free slot")
+	// ErrCountOverflow means a key of a CountingTable already has the
+	// largest count it can record.
+	ErrCountOverflow = errors.New("key count overflow")
+)
+
+// Kind identifies the table layout an error comes from.
+type Kind int
+
+const (
+	KindElastic Kind = iota + 1
+	KindFunnel
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindElastic:
+		return "elastic"
+	case KindFunnel:
+		return "funnel"
+	}
+	return "unknown"
+}
+
+// TableError describes a failed operation: which table, how full it was and,
+// for placement failures, the level at which the key could go no further.
+type TableError struct {
+	Kind     Kind
+	Size     int   // number of keys at the time of the failure
+	Capacity int   // maximum number of keys
+	Level    int   // level where placement failed, -1 if not applicable; a funnel table's special array is level len(levels)
+	Err      error // one of the Err* values, possibly wrapped with details
+}
+
+func (e *TableError) Error() string {
+	s := fmt.Sprintf("%s hash table: %v (size %d, capacity %d", e.Kind, e.Err, e.Size, e.Capacity)
+	if e.Level >= 0 {
+		s += fmt.Sprintf(", level %d", e.Level)
+	}
+	return s + ")"
+}
+
+func (e *TableError) Unwrap() error {
+	return e.Err
+}
+
+// invalidParams is the value constructors panic with. Tables built on the
+// funnel layout, such as Cache, report KindFunnel.
+func invalidParams(kind Kind, detail string) *TableError {
+	return &TableError{Kind: kind, Level: -1, Err: fmt.Errorf("%w: %s", ErrInvalidParams, detail)}
+}
+
+// fail wraps err in a TableError describing ht.
+func (ht *ElasticHashTable) fail(err error, level int) error {
+	return &TableError{Kind: KindElastic, Size: ht.Size(), Capacity: ht.capacity, Level: level, Err: err}
+}
+
+// fail wraps err in a TableError describing ht.
+func (ht *FunnelHashTable) fail(err error, level int) error {
+	return &TableError{Kind: KindFunnel, Size: ht.Size(), Capacity: ht.capacity, Level: level, Err: err}
+}
+
+// noSlot reports a key that found no free slot down to the final level:
+// ErrProbeLimit if the probe limit keeps insertions from scanning the whole
+// level, ErrNoSlot otherwise.
+func (ht *ElasticHashTable) noSlot() error {
+	last := len(ht.levels[ht.L-1])
+	if scanBudget(ht.probeLimit, last) < last {
+		return ht.fail(ErrProbeLimit, ht.L-1)
+	}
+	return ht.fail(ErrNoSlot, ht.L-1)
+}
+
+// noSlot reports a key that found no free slot down to the special array,
+// see ElasticHashTable.noSlot.
+func (ht *FunnelHashTable) noSlot() error {
+	if scanBudget(ht.probeLimit, len(ht.special)) < len(ht.special) {
+		return ht.fail(ErrProbeLimit, len(ht.levels))
+	}
+	return ht.fail(ErrNoSlot, len(ht.levels))
+}
@@ -0,0 +1,140 @@
+package elastichash
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTypedErrors(t *testing.T) {
+	eht := NewElasticHashTable(100, 0.1)
+	fht := NewFunnelHashTable(100, 4, 0.1)
+	for _, tc := range []struct {
+		name string
+		kind Kind
+		ht   slotTable
+		snap func() Table
+	}{
+		{"Elastic", KindElastic, eht, func() Table { return eht.Snapshot() }},
+		{"Funnel", KindFunnel, fht, func() Table { return fht.Snapshot() }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ht := tc.ht
+			for _, key := range []int{EMPTY, TOMBSTONE} {
+				if err := ht.Insert(key); !errors.Is(err, ErrInvalidKey) {
+					t.Errorf("Insert(%d): expected ErrInvalidKey, got %v", key, err)
+				}
+			}
+			if err := tc.snap().Insert(1); !errors.Is(err, ErrReadOnly) {
+				t.Errorf("Insert into a snapshot: expected ErrReadOnly, got %v", err)
+			}
+
+			for k := 0; ht.Size() < ht.Capacity(); k++ {
+				ht.Insert(k)
+			}
+			err := ht.Insert(1000)
+			if !errors.Is(err, ErrFull) {
+				t.Fatalf("Expected ErrFull, got %v", err)
+			}
+			var te *TableError
+			if !errors.As(err, &te) {
+				t.Fatalf("Expected a *TableError, got %T", err)
+			}
+			if te.Kind != tc.kind || te.Size != ht.Capacity() || te.Capacity != ht.Capacity() || te.Level != -1 {
+				t.Errorf("Unexpected error details: %+v", te)
+			}
+			if err.Error() == "" || errors.Is(err, ErrNoSlot) {
+				t.Errorf("Error %q should describe the failure and only match ErrFull", err)
+			}
+		})
+	}
+}
+
+func TestConstructorErrors(t *testing.T) {
+	expectPanic := func(name string, kind Kind, fn func()) {
+		t.Helper()
+		defer func() {
+			err, _ := recover().(error)
+			var te *TableError
+			if !errors.Is(err, ErrInvalidParams) || !errors.As(err, &te) || te.Kind != kind {
+				t.Errorf("%s: expected a %v TableError wrapping ErrInvalidParams, got %v", name, kind, err)
+			}
+		}()
+		fn()
+	}
+	expectPanic("elastic delta", KindElastic, func() { NewElasticHashTable(100, 1) })
+	expectPanic("funnel delta", KindFunnel, func() { NewFunnelHashTable(100, 4, -0.5) })
+	expectPanic("funnel bucket size", KindFunnel, func() { NewFunnelHashTable(100, 0, 0.1) })
+	expectPanic("cache capacity", KindFunnel, func() {
+		NewCache[int, int](0, 4, func(k int) uint64 { return uint64(k) })
+	})
+	expectPanic("shard bits", KindElastic, func() { NewShardedElasticTable(17, 100, 0.1) })
+	expectPanic("funnel shard bits", KindFunnel, func() { NewShardedFunnelTable(-1, 100, 4, 0.1) })
+	expectPanic("ContainsBatch output", KindFunnel, func() {
+		NewFunnelHashTable(100, 4, 0.1).ContainsBatch([]int{1, 2}, make([]bool, 1))
+	})
+
+	if _, err := NewElasticHashTableFrom([]int{1}, 2); !errors.Is(err, ErrInvalidParams) {
+		t.Errorf("Bulk constructor with bad delta: expected ErrInvalidParams, got %v", err)
+	}
+	if _, err := NewFunnelHashTableFrom([]int{1, EMPTY}, 4, 0.1); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Bulk constructor with a marker key: expected ErrInvalidKey, got %v", err)
+	}
+}
+
+func TestTryConstructors(t *testing.T) {
+	hash := func(k int) uint64 { return uint64(k) }
+	for name, err := range map[string]error{
+		"elastic delta":      second(TryNewElasticHashTable(100, 1, ElasticOptions{})),
+		"elastic probes":     second(TryNewElasticHashTable(100, 0.1, ElasticOptions{Probes: -1})),
+		"funnel bucket size": second(TryNewFunnelHashTable(100, 0, 0.1, FunnelOptions{})),
+		"cache capacity":     second(TryNewCache[int, int](0, 4, hash)),
+		"shard bits":         second(TryNewShardedElasticTable(17, 100, 0.1)),
+		"funnel shard delta": second(TryNewShardedFunnelTable(2, 100, 4, 1.5)),
+	} {
+		if !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("%s: expected ErrInvalidParams, got %v", name, err)
+		}
+	}
+
+	eht, err := TryNewElasticHashTable(100, 0.1, ElasticOptions{Probes: 6})
+	if err != nil || eht.R != 6 {
+		t.Errorf("Valid elastic parameters rejected: %v", err)
+	}
+	if _, err := TryNewFunnelHashTable(100, 4, 0.1, FunnelOptions{Aligned: true}); err != nil {
+		t.Errorf("Valid funnel parameters rejected: %v", err)
+	}
+	if _, err := TryNewCache[int, int](10, 4, hash); err != nil {
+		t.Errorf("Valid cache parameters rejected: %v", err)
+	}
+	if st, err := TryNewShardedFunnelTable(2, 100, 4, 0.1); err != nil || st.Insert(1) != nil {
+		t.Errorf("Valid sharded parameters rejected: %v", err)
+	}
+}
+
+// second returns the error of a constructor result.
+func second[T any](_ T, err error) error { return err }
+
+func TestBatchInvalidKey(t *testing.T) {
+	ht := NewElasticHashTable(100, 0.1)
+	if err := ht.InsertBatch([]int{1, 2, TOMBSTONE, 3}); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Expected ErrInvalidKey, got %v", err)
+	}
+	if ht.Size() != 0 || ht.Contains(1) {
+		t.Errorf("A batch with an invalid key should change nothing")
+	}
+}
+
+func TestCountOverflow(t *testing.T) {
+	ct := NewCountingFunnelTable(100, 4, 0.1)
+	ct.Insert(5)
+	ref, _ := ct.t.find(5)
+	ct.counts[ref.lvl][ref.pos] = ^uint32(0)
+	err := ct.Insert(5)
+	var te *TableError
+	if !errors.Is(err, ErrCountOverflow) || !errors.As(err, &te) || te.Kind != KindFunnel {
+		t.Errorf("Expected a funnel TableError wrapping ErrCountOverflow, got %v", err)
+	}
+	if ct.Count(5) != int(^uint32(0)) {
+		t.Errorf("Failed insert changed the count to %d", ct.Count(5))
+	}
+}
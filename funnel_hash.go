@@ -1,9 +1,7 @@
 package elastichash
 
 import (
-	"errors"
 	"fmt"
-	"runtime"
 	"sync/atomic"
 )
 
@@ -11,41 +9,162 @@ type FunnelHashTable struct {
 	levels    []Level   // slice of levels 0..B-1
 	special   []int     // special overflow array
 	b         int       // bucket size (slots per bucket)
+	stride    int       // slots from one bucket start to the next, b unless aligned
+	aligned   bool      // level slots are cache line aligned (see FunnelOptions)
 	size      int32     // atomic counter for thread safety
 	capacity  int
+	delta     float64   // fraction of slots left empty, as passed to the constructor
+	readOnly  bool      // set for read-only memory-mapped tables
+	release   func() error // releases external memory backing the slots (see Close)
+	offHeap   bool      // slots were allocated with FunnelOptions.OffHeap
+	shared    []bool    // levels (then special) still shared with a snapshot, nil if none was taken
+	filter    *bloomFilter // optional prefilter for Contains, see EnablePrefilter
+	filterShared bool   // filter still shared with a snapshot
+	index     *orderedIndex // optional ordered index for RangeKeys, see EnableOrderedIndex
+	probeLimit int      // max special slots an insertion scans, 0 for all (see SetProbeLimit)
+	scanLimit  int      // every special key lies this close to its start, 0 if unknown
 }
 
 // Each level has an array of buckets. We store as a flat slice and compute bucket indices.
 type Level struct {
-	slots      []int  // length = number of buckets * b
+	slots      []int  // length = number of buckets * stride
 	numBuckets int
-	mask       uint32 // bit mask for fast modulo (power of 2 optimization)
+}
+
+// FunnelOptions tunes a FunnelHashTable beyond its size, bucket size and
+// delta.
+type FunnelOptions struct {
+	// Aligned allocates each level on a cache line boundary and pads
+	// buckets to a power-of-two stride dividing the line (or to whole lines
+	// for buckets larger than one), so that a bucket scan touches a single
+	// cache line. Padding costs memory unless b is a power of two: with b=3
+	// or b=6 a third of the level slots go unused.
+	Aligned bool
+	// OffHeap places the levels and the special array outside the Go heap,
+	// see ElasticOptions.OffHeap. Each level then starts on a cache line.
+	OffHeap bool
 }
 
 // NewFunnelHashTable creates a FunnelHashTable with given total size N, bucket size b, and empty fraction delta.
+// Keys that find all their buckets full go to the special array, which small
+// buckets overflow before the table reaches Capacity: with b=1 insertions
+// start failing at about 78-89% of Capacity, with b=2 and delta up to 0.1 at
+// about 94-98%, and with b=3 or 4 only for delta near 0.01. Larger buckets
+// and deltas fill to Capacity. NewFunnelForCapacity sizes N to avoid this.
 func NewFunnelHashTable(N int, b int, delta float64) *FunnelHashTable {
-	if delta < 0 || delta >= 1 {
-		panic("delta must be in (0,1)")
+	return NewFunnelHashTableWithOptions(N, b, delta, FunnelOptions{})
+}
+
+// NewFunnelHashTableWithOptions creates a FunnelHashTable like
+// NewFunnelHashTable, tuned by opts. N counts the slots in use; padding
+// added by opts.Aligned comes on top. It panics where TryNewFunnelHashTable
+// returns an error.
+func NewFunnelHashTableWithOptions(N int, b int, delta float64, opts FunnelOptions) *FunnelHashTable {
+	ht, err := TryNewFunnelHashTable(N, b, delta, opts)
+	if err != nil {
+		panic(err)
 	}
-	
-	// Determine number of levels B, with optimized distribution
-	B := 3
-	if delta < 0.1 {
-		// For very low delta, use more levels
-		B = 4
+	return ht
+}
+
+// TryNewFunnelHashTable is NewFunnelHashTableWithOptions returning an error
+// instead of panicking, see TryNewElasticHashTable.
+func TryNewFunnelHashTable(N int, b int, delta float64, opts FunnelOptions) (*FunnelHashTable, error) {
+	if delta < 0 || delta >= 1 {
+		return nil, invalidParams(KindFunnel, "delta must be in (0,1)")
 	}
-	if B < 1 {
-		B = 1
+	if b < 1 {
+		return nil, invalidParams(KindFunnel, "bucket size must be positive")
 	}
 	
+	buckets, specialSize := funnelLayout(N, b, delta)
+	
 	// Total allowed elements:
 	maxElems := int((1 - delta) * float64(N))
 	ht := &FunnelHashTable{
-		levels:   make([]Level, B),
+		levels:   make([]Level, len(buckets)),
 		special:  []int{},
 		b:        b,
+		stride:   bucketStride(b, opts.Aligned),
+		aligned:  opts.Aligned,
 		size:     0,
 		capacity: maxElems,
+		delta:    delta,
+	}
+	
+	if opts.OffHeap {
+		sizes := make([]int, len(buckets)+1)
+		for i, numB := range buckets {
+			sizes[i] = numB * ht.stride
+		}
+		sizes[len(buckets)] = specialSize
+		slots, release, err := offHeapSlots(sizes)
+		if err != nil {
+			return nil, ht.fail(err, -1)
+		}
+		for i, numB := range buckets {
+			ht.levels[i] = Level{slots: slots[i], numBuckets: numB}
+		}
+		ht.special, ht.release, ht.offHeap = slots[len(buckets)], release, true
+		return ht, nil
+	}
+	
+	for i, numB := range buckets {
+		var levelSlots []int
+		if ht.aligned {
+			levelSlots = alignedSlots(numB * ht.stride)
+		} else {
+			levelSlots = make([]int, numB*b)
+			for j := range levelSlots {
+				levelSlots[j] = EMPTY
+			}
+		}
+		
+		ht.levels[i] = Level{
+			slots:      levelSlots, 
+			numBuckets: numB,
+		}
+	}
+	
+	ht.special = make([]int, specialSize)
+	for j := range ht.special {
+		ht.special[j] = EMPTY
+	}
+	return ht, nil
+}
+
+// NewFunnelForCapacity creates a FunnelHashTable with bucket size b that
+// holds n keys, leaving about a delta fraction of its slots empty. Its
+// Capacity is at least n, and it has room for n keys: keys that find their
+// buckets full go to the special array, and with small buckets (b=2) or a
+// delta near zero more of them do than n/(1-delta) slots leave room for, so
+// N is then grown, by up to 10% for b=2, until the expected overflow fits with
+// a safety margin. EstimateSize reports the same N beforehand; only tiny
+// tables get a few more slots, as every level needs at least one bucket.
+func NewFunnelForCapacity(n int, b int, delta float64) *FunnelHashTable {
+	if delta < 0 || delta >= 1 {
+		panic(invalidParams(KindFunnel, "delta must be in (0,1)"))
+	}
+	if b < 1 {
+		panic(invalidParams(KindFunnel, "bucket size must be positive"))
+	}
+	if n < 0 {
+		panic(invalidParams(KindFunnel, "element count must not be negative"))
+	}
+	return NewFunnelHashTable(funnelSlotsFor(n, b, delta), b, delta)
+}
+
+// funnelLayout computes the number of buckets of each level and the size of
+// the special array for a funnel table of total size N.
+func funnelLayout(N int, b int, delta float64) (buckets []int, specialSize int) {
+	// Determine number of levels B, with optimized distribution
+	B := 3
+	if delta < 0.1 {
+		// For very low delta, use more levels
+		B = 4
+	}
+	if B < 1 {
+		B = 1
 	}
 	
 	// Revised sizing strategy based on paper analysis
@@ -70,14 +189,12 @@ func NewFunnelHashTable(N int, b int, delta float64) *FunnelHashTable {
 		}
 	}
 	
-	// Allocate levels, try to use power of 2 sizes for faster modulo operation
+	// Size levels exactly; bucket indices use multiply-shift reduction, so
+	// sizes need not be powers of two
+	buckets = make([]int, B)
 	allocated := 0
 	for i := 0; i < B; i++ {
 		size_i := int(sizes[i] * float64(N))
-		if i == B-1 {
-			// Ensure last level has enough space
-			size_i = int(sizes[i] * float64(N))
-		}
 		
 		// Ensure minimum bucket size
 		if size_i < b {
@@ -87,62 +204,27 @@ func NewFunnelHashTable(N int, b int, delta float64) *FunnelHashTable {
 		// Number of buckets = size_i / b (truncate)
 		numB := size_i / b
 		
-		// Try to round to power of 2 for faster modulo operation
-		powerOf2 := 1
-		for powerOf2 < numB {
-			powerOf2 <<= 1
-		}
-		
-		// Use power of 2 if it doesn't increase size too much
-		if powerOf2 <= numB*5/4 {
-			numB = powerOf2
-		}
-		
-		// Compute mask for fast modulo if numB is power of 2
-		var mask uint32 = 0
-		if numB > 0 && (numB & (numB-1)) == 0 {
-			mask = uint32(numB - 1)
-		}
-		
-		levelSlots := make([]int, numB*b)
-		for j := range levelSlots {
-			levelSlots[j] = EMPTY
-		}
-		
-		ht.levels[i] = Level{
-			slots:      levelSlots, 
-			numBuckets: numB,
-			mask:       mask,
-		}
+		buckets[i] = numB
 		allocated += numB * b
 	}
 	
 	// Special array gets remaining slots
-	specialSize := N - allocated
+	specialSize = N - allocated
 	if specialSize < 1 {
 		specialSize = 1
 	}
-	
-	// Round special array to power of 2 for better performance if reasonable
-	powerOf2 := 1
-	for powerOf2 < specialSize {
-		powerOf2 <<= 1
-	}
-	if powerOf2 <= specialSize*5/4 {
-		specialSize = powerOf2
-	}
-	
-	ht.special = make([]int, specialSize)
-	for j := range ht.special {
-		ht.special[j] = EMPTY
-	}
-	return ht
+	return buckets, specialSize
 }
 
 // hashFunc for funnel hashing: (key, level) -> bucket index in that level.
-// Uses fast modulo if level's numBuckets is a power of 2
 // This version uses a high-performance Murmur-inspired hash
 func (ht *FunnelHashTable) hashFunc(key int, levelIdx int) int {
+	return ht.bucket(mixKey(key), levelIdx)
+}
+
+// mixKey is the level-independent part of hashFunc. Callers visiting several
+// levels compute it once and pass it to bucket.
+func mixKey(key int) uint32 {
 	// Optimized 32-bit mix (inspired by Murmur3)
 	h := uint32(key)
 	h ^= h >> 16
@@ -150,101 +232,140 @@ func (ht *FunnelHashTable) hashFunc(key int, levelIdx int) int {
 	h ^= h >> 13
 	h *= 0xc2b2ae35
 	h ^= h >> 16
-	
-	level := ht.levels[levelIdx]
-	
-	// Use bit masking for fast modulo if numBuckets is power of 2
-	if level.mask > 0 {
-		return int(h & level.mask)
-	}
-	
-	return int(h % uint32(level.numBuckets))
+	return h
+}
+
+// bucket maps a mixed key to a bucket index in the given level. Each level
+// rescrambles h with its own constant: the reduction keeps the high bits of
+// h, so without it keys sharing a full bucket in one level would all
+// overflow into the same bucket of the next.
+func (ht *FunnelHashTable) bucket(h uint32, levelIdx int) int {
+	h += uint32(levelIdx) * 0x9e3779b9
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	// Lemire's multiply-shift reduction: as fast as masking, for any count
+	return int((uint64(h) * uint64(ht.levels[levelIdx].numBuckets)) >> 32)
 }
 
-// Insert inserts a key into the funnel hash table.
+// specialStart returns the first slot of key's linear probing sequence in
+// the special array, which uses its own multiplicative hash.
+func (ht *FunnelHashTable) specialStart(key int) int {
+	h := uint32(key) * 0x9e3779b1
+	return int((uint64(h) * uint64(len(ht.special))) >> 32)
+}
+
+// Insert inserts a key into the funnel hash table. Like
+// ElasticHashTable.Insert it walks the key's buckets, then the special array,
+// a single time.
 func (ht *FunnelHashTable) Insert(key int) error {
+	_, err := ht.insert(key)
+	return err
+}
+
+// insert implements Insert and Add.
+func (ht *FunnelHashTable) insert(key int) (bool, error) {
+	if ht.readOnly {
+		return false, ht.fail(ErrReadOnly, -1)
+	}
+	if key == EMPTY || key == TOMBSTONE {
+		return false, ht.fail(ErrInvalidKey, -1)
+	}
+	ref, found := ht.find(key)
+	if found {
+		return false, nil
+	}
 	if atomic.LoadInt32(&ht.size) >= int32(ht.capacity) {
-		return errors.New("hash table is full")
+		return false, ht.fail(ErrFull, -1)
 	}
-	
-	// Quick duplicate check in thread-safe way
-	if ht.Contains(key) {
-		return nil
+	if ref.lvl < 0 {
+		return false, ht.noSlot()
 	}
-	
-	// Cache b for better performance (avoid field access)
+	ht.own(ref.lvl)
+	ht.segment(ref.lvl)[ref.pos] = key
+	atomic.AddInt32(&ht.size, 1)
+	ht.addToFilter(key)
+	ht.indexAdd(key)
+	return true, nil
+}
+
+// find walks the buckets of key once, in the order Insert visits them,
+// hashing the key a single time. See ElasticHashTable.find for the results;
+// the special array is reported as level len(levels).
+func (ht *FunnelHashTable) find(key int) (slotRef, bool) {
+	free := slotRef{lvl: -1}
 	b := ht.b
-	
-	// Try each level in order
+	h := mixKey(key)
 	for i := 0; i < len(ht.levels); i++ {
-		lvl := &ht.levels[i]
-		bucketIdx := ht.hashFunc(key, i)
-		start := bucketIdx * b  // index of first slot in this bucket
-		
-		// First check if key already exists in this bucket
-		for j := 0; j < b; j++ {
-			slotIndex := start + j
-			if lvl.slots[slotIndex] == key {
-				return nil // already exists
-			}
-		}
-		
-		// Now look for an empty or tombstone slot
-		for j := 0; j < b; j++ {
-			slotIndex := start + j
-			if lvl.slots[slotIndex] == EMPTY || lvl.slots[slotIndex] == TOMBSTONE {
-				lvl.slots[slotIndex] = key
-				atomic.AddInt32(&ht.size, 1)
-				return nil
+		slots := ht.levels[i].slots
+		start := ht.bucket(h, i) * ht.stride
+		for j := start; j < start+b; j++ {
+			switch slots[j] {
+			case key:
+				return slotRef{i, j}, true
+			case EMPTY:
+				if free.lvl < 0 {
+					free = slotRef{i, j}
+				}
+				return free, false
+			case TOMBSTONE:
+				if free.lvl < 0 {
+					free = slotRef{i, j}
+				}
 			}
 		}
-		// If bucket is full, fall through to next level
-		runtime.Gosched() // Yield to other goroutines - helps with contention
 	}
-	
-	// If all levels failed, insert into special overflow
-	// Optimize special array for power of 2 size if possible
+
+	// Special array: linear probing with its own hash
+	sp := len(ht.levels)
 	m := len(ht.special)
-	h0 := uint32(key) * 0x9e3779b1  // different hash for special array
-	
-	// Fast path if m is power of 2
-	if m > 0 && (m & (m-1)) == 0 {
-		mask := uint32(m - 1)
-		start := h0 & mask
-		
-		// First check if key already exists
-		for offset := uint32(0); offset < uint32(m); offset++ {
-			pos := int((start + offset) & mask)
-			if ht.special[pos] == key {
-				return nil
-			}
-			if ht.special[pos] == EMPTY || ht.special[pos] == TOMBSTONE {
-				ht.special[pos] = key
-				atomic.AddInt32(&ht.size, 1)
-				return nil
+	pos := ht.specialStart(key)
+	budget := scanBudget(ht.probeLimit, m)
+	for n, end := 0, scanBudget(ht.scanLimit, m); n < end; n++ {
+		switch ht.special[pos] {
+		case key:
+			return slotRef{sp, pos}, true
+		case EMPTY:
+			if free.lvl < 0 && n < budget {
+				free = slotRef{sp, pos}
+			}
+			return free, false
+		case TOMBSTONE:
+			if free.lvl < 0 && n < budget {
+				free = slotRef{sp, pos}
 			}
 		}
-	} else {
-		// Standard linear probing for non-power-of-2 sizes
-		start := int(h0 % uint32(m))
-		for offset := 0; offset < m; offset++ {
-			pos := (start + offset) % m
-			if ht.special[pos] == key {
-				return nil
-			}
-			if ht.special[pos] == EMPTY || ht.special[pos] == TOMBSTONE {
-				ht.special[pos] = key
-				atomic.AddInt32(&ht.size, 1)
-				return nil
-			}
+		if pos++; pos == m {
+			pos = 0
 		}
 	}
-	
-	return errors.New("special array is full - insertion failed")
+	return free, false
+}
+
+// segment returns the slots of level i, or the special array for i == len(levels).
+func (ht *FunnelHashTable) segment(i int) []int {
+	if i == len(ht.levels) {
+		return ht.special
+	}
+	return ht.levels[i].slots
+}
+
+// numSegments returns the number of levels plus one for the special array,
+// for use with segment.
+func (ht *FunnelHashTable) numSegments() int {
+	return len(ht.levels) + 1
+}
+
+// addSize adjusts the element count after slots were written directly.
+func (ht *FunnelHashTable) addSize(n int) {
+	atomic.AddInt32(&ht.size, int32(n))
 }
 
 // Contains checks if a key exists in the table.
 func (ht *FunnelHashTable) Contains(key int) bool {
+	if ht.filter != nil && !ht.filter.mayContain(key) {
+		return false
+	}
 	// Use local variables to avoid repeated field accesses
 	b := ht.b
 	
@@ -252,7 +373,7 @@ func (ht *FunnelHashTable) Contains(key int) bool {
 	for i := 0; i < len(ht.levels); i++ {
 		lvl := &ht.levels[i]
 		bucketIdx := ht.hashFunc(key, i)
-		start := bucketIdx * b
+		start := bucketIdx * ht.stride
 		
 		// Optimized unrolled version for common bucket sizes
 		switch {
@@ -385,35 +506,18 @@ func (ht *FunnelHashTable) Contains(key int) bool {
 	
 	// Check special overflow array
 	m := len(ht.special)
-	h0 := uint32(key) * 0x9e3779b1  // Different hash for special array
-	
-	// Fast path if m is power of 2
-	if m > 0 && (m & (m-1)) == 0 {
-		mask := uint32(m - 1)
-		start := h0 & mask
-		
-		for offset := uint32(0); offset < uint32(m); offset++ {
-			pos := int((start + offset) & mask)
-			if ht.special[pos] == key {
-				return true
-			}
-			if ht.special[pos] == EMPTY {
-				return false
-			}
-			// Continue on tombstones
+	pos := ht.specialStart(key)
+	limit := scanBudget(ht.scanLimit, m)
+	for offset := 0; offset < limit; offset++ {
+		if ht.special[pos] == key {
+			return true
 		}
-	} else {
-		// Standard linear probing for non-power-of-2 sizes
-		start := int(h0 % uint32(m))
-		for offset := 0; offset < m; offset++ {
-			pos := (start + offset) % m
-			if ht.special[pos] == key {
-				return true
-			}
-			if ht.special[pos] == EMPTY {
-				return false
-			}
-			// Continue on tombstones
+		if ht.special[pos] == EMPTY {
+			return false
+		}
+		// Continue on tombstones
+		if pos++; pos == m {
+			pos = 0
 		}
 	}
 	
@@ -423,6 +527,9 @@ func (ht *FunnelHashTable) Contains(key int) bool {
 // Remove deletes a key from the hash table if it exists.
 // Returns true if the key was found and removed, false otherwise.
 func (ht *FunnelHashTable) Remove(key int) bool {
+	if ht.readOnly {
+		return false
+	}
 	// Cache b for better performance
 	b := ht.b
 	
@@ -430,15 +537,17 @@ func (ht *FunnelHashTable) Remove(key int) bool {
 	for i := 0; i < len(ht.levels); i++ {
 		lvl := &ht.levels[i]
 		bucketIdx := ht.hashFunc(key, i)
-		start := bucketIdx * b
+		start := bucketIdx * ht.stride
 		
 		// Search all slots in this bucket
 		for j := 0; j < b; j++ {
 			slotIndex := start + j
 			if lvl.slots[slotIndex] == key {
 				// Found the key - mark as deleted
+				ht.own(i)
 				lvl.slots[slotIndex] = TOMBSTONE
 				atomic.AddInt32(&ht.size, -1)
+				ht.indexRemove(key)
 				return true
 			}
 			if lvl.slots[slotIndex] == EMPTY {
@@ -451,43 +560,40 @@ func (ht *FunnelHashTable) Remove(key int) bool {
 	
 	// Check special overflow array
 	m := len(ht.special)
-	h0 := uint32(key) * 0x9e3779b1  // Different hash for special array
-	
-	// Fast path if m is power of 2
-	if m > 0 && (m & (m-1)) == 0 {
-		mask := uint32(m - 1)
-		start := h0 & mask
-		
-		for offset := uint32(0); offset < uint32(m); offset++ {
-			pos := int((start + offset) & mask)
-			if ht.special[pos] == key {
-				ht.special[pos] = TOMBSTONE 
-				atomic.AddInt32(&ht.size, -1)
-				return true
-			}
-			if ht.special[pos] == EMPTY {
-				return false
-			}
+	pos := ht.specialStart(key)
+	limit := scanBudget(ht.scanLimit, m)
+	for offset := 0; offset < limit; offset++ {
+		if ht.special[pos] == key {
+			ht.own(len(ht.levels))
+			ht.special[pos] = TOMBSTONE
+			atomic.AddInt32(&ht.size, -1)
+			ht.indexRemove(key)
+			return true
 		}
-	} else {
-		// Standard linear probing for non-power-of-2 sizes
-		start := int(h0 % uint32(m))
-		for offset := 0; offset < m; offset++ {
-			pos := (start + offset) % m
-			if ht.special[pos] == key {
-				ht.special[pos] = TOMBSTONE
-				atomic.AddInt32(&ht.size, -1)
-				return true
-			}
-			if ht.special[pos] == EMPTY {
-				return false
-			}
+		if ht.special[pos] == EMPTY {
+			return false
+		}
+		if pos++; pos == m {
+			pos = 0
 		}
 	}
 	
 	return false
 }
 
+// Range calls fn for every key in the table, level by level and then the
+// special array, until fn returns false. The table must not be modified
+// during the iteration.
+func (ht *FunnelHashTable) Range(fn func(key int) bool) {
+	for i := 0; i <= len(ht.levels); i++ {
+		for _, v := range ht.segment(i) {
+			if v != EMPTY && v != TOMBSTONE && !fn(v) {
+				return
+			}
+		}
+	}
+}
+
 // Size returns the current number of elements in the table.
 func (ht *FunnelHashTable) Size() int {
 	return int(atomic.LoadInt32(&ht.size))
@@ -498,6 +604,25 @@ func (ht *FunnelHashTable) Capacity() int {
 	return ht.capacity
 }
 
+// Close releases memory backing the table when it was opened from a mapped
+// file or created with FunnelOptions.OffHeap, see ElasticHashTable.Close.
+func (ht *FunnelHashTable) Close() error {
+	if ht.release == nil {
+		return nil
+	}
+	err := ht.release()
+	ht.release, ht.offHeap = nil, false
+	for i := range ht.levels {
+		ht.levels[i] = Level{slots: make([]int, ht.stride), numBuckets: 1}
+		for j := range ht.levels[i].slots {
+			ht.levels[i].slots[j] = EMPTY
+		}
+	}
+	ht.special = []int{EMPTY}
+	atomic.StoreInt32(&ht.size, 0)
+	return err
+}
+
 // String returns a debug representation of the hash table.
 func (ht *FunnelHashTable) String() string {
 	str := fmt.Sprintf("FunnelHashTable: size=%d, capacity=%d, bucketSize=%d\n", ht.Size(), ht.capacity, ht.b)
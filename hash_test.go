@@ -227,6 +227,50 @@ func TestFunnelHashTable(t *testing.T) {
 	}
 }
 
+func TestForCapacity(t *testing.T) {
+	fill := func(t *testing.T, ht Table, n int) {
+		t.Helper()
+		for k := 0; k < n; k++ {
+			if err := ht.Insert(k); err != nil {
+				t.Fatalf("Insert(%d) of %d: %v", k, n, err)
+			}
+		}
+	}
+	for _, n := range []int{0, 1, 7, 100, 1000, 12345} {
+		for _, delta := range []float64{0, 0.01, 0.05, 0.1, 0.37} {
+			eht := NewElasticForCapacity(n, delta)
+			if eht.Capacity() < n {
+				t.Errorf("n=%d delta=%v: elastic capacity %d", n, delta, eht.Capacity())
+			}
+			est, _ := EstimateSize(n, delta, EstimateOptions{})
+			if got := eht.MemoryUsage().Slots / wordBytes; n >= 100 && got != int64(est.N) {
+				t.Errorf("n=%d delta=%v: elastic table has %d slots, want %d", n, delta, got, est.N)
+			}
+			t.Run(fmt.Sprintf("Elastic/n=%d/delta=%v", n, delta), func(t *testing.T) { fill(t, eht, n) })
+
+			for _, b := range []int{2, 4, 8} {
+				fht := NewFunnelForCapacity(n, b, delta)
+				if fht.Capacity() < n {
+					t.Errorf("n=%d b=%d delta=%v: funnel capacity %d", n, b, delta, fht.Capacity())
+				}
+				est, _ := EstimateSize(n, delta, EstimateOptions{Kind: KindFunnel, BucketSize: b})
+				if got := fht.MemoryUsage().Slots / wordBytes; n >= 100 && got != int64(est.N) {
+					t.Errorf("n=%d b=%d delta=%v: funnel table has %d slots, want %d", n, b, delta, got, est.N)
+				}
+				t.Run(fmt.Sprintf("Funnel/n=%d/b=%d/delta=%v", n, b, delta), func(t *testing.T) { fill(t, fht, n) })
+			}
+		}
+	}
+
+	// Sizes where exact n/(1-delta) sizing ran out of special slots
+	for _, tc := range []struct {
+		n, b  int
+		delta float64
+	}{{100000, 4, 0}, {10000, 2, 0.01}, {200000, 2, 0.1}, {10000, 4, 0.01}} {
+		fill(t, NewFunnelForCapacity(tc.n, tc.b, tc.delta), tc.n)
+	}
+}
+
 func TestHashPerformance(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping performance test in short mode")
@@ -340,23 +384,45 @@ func BenchmarkElasticHashLookup(b *testing.B) {
 	}
 }
 
+// BenchmarkFunnelHashLookup also compares the packed and cache line aligned
+// layouts, at a size that fits in cache and at one that does not. With b=6 a
+// packed bucket straddles two cache lines a third of the time.
 func BenchmarkFunnelHashLookup(b *testing.B) {
-	N := 10000
 	delta := 0.1 // 90% load factor
-	bucketSize := 8
-	fht := NewFunnelHashTable(N, bucketSize, delta)
-
-	// Insert half the capacity
-	targetSize := fht.Capacity() / 2
-	for i := 0; i < targetSize; i++ {
-		fht.Insert(i)
-	}
+	for _, tc := range []struct {
+		N, bucketSize int
+	}{
+		{10000, 8},
+		{1 << 24, 8},
+		{1 << 24, 6},
+	} {
+		if tc.N > 1<<20 && testing.Short() {
+			continue
+		}
+		for _, layout := range []struct {
+			name string
+			opts FunnelOptions
+		}{
+			{"Packed", FunnelOptions{}},
+			{"Aligned", FunnelOptions{Aligned: true}},
+		} {
+			fht := NewFunnelHashTableWithOptions(tc.N, tc.bucketSize, delta, layout.opts)
+
+			// Insert half the capacity
+			targetSize := fht.Capacity() / 2
+			for i := 0; i < targetSize; i++ {
+				fht.Insert(i)
+			}
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		// Mix of successful and unsuccessful lookups
-		key := i % (targetSize * 2)
-		fht.Contains(key)
+			name := fmt.Sprintf("N=%d/b=%d/%s", tc.N, tc.bucketSize, layout.name)
+			b.Run(name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					// Mix of successful and unsuccessful lookups
+					key := i % (targetSize * 2)
+					fht.Contains(key)
+				}
+			})
+		}
 	}
 }
 
@@ -664,4 +730,32 @@ func BenchmarkUnsuccessfulLookup(b *testing.B) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+// BenchmarkInsertFill fills a table to capacity, so later insertions run at
+// high load where the duplicate check and the slot search are most costly.
+func BenchmarkInsertFill(b *testing.B) {
+	const N = 1 << 16
+	const delta = 0.1
+	keys := rand.Perm(N)
+
+	b.Run("ElasticHash", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			eht := NewElasticHashTable(N, delta)
+			for _, key := range keys[:eht.Capacity()] {
+				eht.Insert(key)
+			}
+		}
+		b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N)/float64(N*(1-delta)), "ns/key")
+	})
+
+	b.Run("FunnelHash", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			fht := NewFunnelHashTable(N, 8, delta)
+			for _, key := range keys[:fht.Capacity()] {
+				fht.Insert(key)
+			}
+		}
+		b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N)/float64(N*(1-delta)), "ns/key")
+	})
+}
@@ -0,0 +1,286 @@
+package elastichash
+
+import (
+	"math"
+	"slices"
+	"unsafe"
+)
+
+// orderedIndex keeps the keys of a table in order for RangeKeys. It is a
+// sorted run plus two logs since the last merge into the run: the keys
+// inserted and the keys removed. The table's own operations only append to a
+// log, so they stay O(1) amortised; the work is deferred to range scans,
+// which sort the logs and, once they have grown past a share of the run,
+// merge them into it.
+// Until then a removed key may linger in the run or the inserted log, and a
+// reinserted one appear twice: scans skip repeats and check the keys found
+// in the removed log against the table.
+//
+// The slices are never written in place once filled, only appended to or
+// replaced, so a snapshot can share them through a copy of the struct.
+type orderedIndex struct {
+	run     []int // sorted keys as of the last merge
+	added   keyLog
+	removed keyLog
+}
+
+// keyLog is a list of keys of which keys[:sorted] is in order and without
+// repeats.
+type keyLog struct {
+	keys   []int
+	sorted int
+}
+
+// minLog is the log length below which merges are never triggered.
+const minLog = 64
+
+// newOrderedIndex returns an index over the keys produced by scan.
+func newOrderedIndex(scan func(fn func(key int) bool)) *orderedIndex {
+	var run []int
+	scan(func(key int) bool {
+		run = append(run, key)
+		return true
+	})
+	slices.Sort(run)
+	return &orderedIndex{run: run}
+}
+
+// add records an inserted key, and remove a removed one. has reports whether
+// the table holds a key; it is used when the logs have grown as large as the
+// run and are merged, which bounds the memory taken by operations between
+// scans.
+func (ix *orderedIndex) add(key int, has func(int) bool) {
+	ix.added.keys = append(ix.added.keys, key)
+	ix.bound(has)
+}
+
+func (ix *orderedIndex) remove(key int, has func(int) bool) {
+	ix.removed.keys = append(ix.removed.keys, key)
+	ix.bound(has)
+}
+
+func (ix *orderedIndex) bound(has func(int) bool) {
+	if len(ix.added.keys)+len(ix.removed.keys) >= max(len(ix.run), minLog*16) {
+		ix.compact(has)
+	}
+}
+
+// logLimit is the log length past which a scan merges the logs into a run
+// of n keys. Sorting the logs costs every scan that follows changes up to
+// their length and a merge costs n, so a limit near the square root of n
+// keeps both small when scans and changes alternate.
+func logLimit(n int) int {
+	return minLog + 2*int(math.Sqrt(float64(n)))
+}
+
+// sortedKeys returns the keys of the log in order, without repeats, in a new
+// slice if they were not already.
+func (l keyLog) sortedKeys() []int {
+	if l.sorted == len(l.keys) {
+		return l.keys
+	}
+	fresh := slices.Clone(l.keys[l.sorted:])
+	slices.Sort(fresh)
+	return union(l.keys[:l.sorted], fresh, len(l.keys)/4+minLog)
+}
+
+// union returns the distinct keys of the sorted slices a and b in order, in a
+// new slice with room for spare more. b is usually much shorter than a: each
+// of its keys is placed by a binary search and the keys of a in between are
+// copied as a block.
+func union(a, b []int, spare int) []int {
+	keys := make([]int, 0, len(a)+len(b)+spare)
+	i := 0
+	for _, key := range b {
+		j, found := slices.BinarySearch(a[i:], key)
+		keys = append(keys, a[i:i+j]...)
+		i += j
+		if found || (len(keys) > 0 && keys[len(keys)-1] == key) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return append(keys, a[i:]...)
+}
+
+// compact merges the logs into the run, dropping the removed keys the table
+// no longer holds.
+func (ix *orderedIndex) compact(has func(int) bool) {
+	run := union(ix.run, ix.added.sortedKeys(), 0)
+	out, i := 0, 0
+	for _, key := range ix.removed.sortedKeys() {
+		j, found := slices.BinarySearch(run[i:], key)
+		if !found || has(key) {
+			continue
+		}
+		j += i
+		out += copy(run[out:], run[i:j])
+		i = j + 1
+	}
+	out += copy(run[out:], run[i:])
+	ix.run, ix.added, ix.removed = run[:out], keyLog{}, keyLog{}
+}
+
+// view returns the run and the sorted logs for a scan. With keep set the
+// index is reorganised in place first; a read-only table leaves it as it is
+// and sorts private copies.
+func (ix *orderedIndex) view(has func(int) bool, keep bool) (run, added, removed []int) {
+	if !keep {
+		return ix.run, ix.added.sortedKeys(), ix.removed.sortedKeys()
+	}
+	if limit := logLimit(len(ix.run)); len(ix.added.keys) > limit || len(ix.removed.keys) > limit {
+		ix.compact(has)
+	}
+	for _, l := range []*keyLog{&ix.added, &ix.removed} {
+		l.keys = l.sortedKeys()
+		l.sorted = len(l.keys)
+	}
+	return ix.run, ix.added.keys, ix.removed.keys
+}
+
+// memory returns the size of the index, 0 for nil.
+func (ix *orderedIndex) memory() int64 {
+	if ix == nil {
+		return 0
+	}
+	return int64(unsafe.Sizeof(*ix)) + int64(cap(ix.run)+cap(ix.added.keys)+cap(ix.removed.keys))*wordBytes
+}
+
+// mergeKeys calls fn in order for every distinct key of the sorted slices a
+// and b within [lo, hi], until fn returns false. Keys that also appear in the
+// sorted slice removed are only passed on if has accepts them.
+func mergeKeys(a, b, removed []int, lo, hi int, has func(int) bool, fn func(key int) bool) {
+	i, _ := slices.BinarySearch(a, lo)
+	j, _ := slices.BinarySearch(b, lo)
+	r, _ := slices.BinarySearch(removed, lo)
+	last, seen := 0, false
+	for {
+		var key int
+		switch {
+		case i < len(a) && (j == len(b) || a[i] <= b[j]):
+			key = a[i]
+			i++
+		case j < len(b):
+			key = b[j]
+			j++
+		default:
+			return
+		}
+		if key > hi {
+			return
+		}
+		if seen && key == last {
+			continue
+		}
+		last, seen = key, true
+		for r < len(removed) && removed[r] < key {
+			r++
+		}
+		if r < len(removed) && removed[r] == key && !has(key) {
+			continue
+		}
+		if !fn(key) {
+			return
+		}
+	}
+}
+
+// rangeKeys implements RangeKeys for a table with index ix (nil for none),
+// whose keys are tested by has and listed by scan. keep is false for
+// read-only tables.
+func rangeKeys(ix *orderedIndex, keep bool, has func(int) bool, scan func(fn func(key int) bool), lo, hi int, fn func(key int) bool) {
+	if lo > hi {
+		return
+	}
+	if ix == nil {
+		var keys []int
+		scan(func(key int) bool {
+			if key >= lo && key <= hi {
+				keys = append(keys, key)
+			}
+			return true
+		})
+		slices.Sort(keys)
+		for _, key := range keys {
+			if !fn(key) {
+				return
+			}
+		}
+		return
+	}
+	run, added, removed := ix.view(has, keep)
+	mergeKeys(run, added, removed, lo, hi, has, fn)
+}
+
+// EnableOrderedIndex attaches an ordered index of the keys, built from the
+// current contents, so that RangeKeys visits the keys of a range without
+// scanning the table. Insert, Add, Replace, Remove and their batch forms keep
+// the index up to date at the cost of an append per key; the
+// index is reorganised lazily by the range scans themselves. It holds up to
+// two words per key. Snapshots share the index; decoded tables and tables
+// built from other tables have none.
+func (ht *ElasticHashTable) EnableOrderedIndex() {
+	ht.index = newOrderedIndex(ht.Range)
+}
+
+// DisableOrderedIndex detaches the ordered index.
+func (ht *ElasticHashTable) DisableOrderedIndex() {
+	ht.index = nil
+}
+
+// RangeKeys calls fn in ascending order for every key k with lo <= k <= hi,
+// until fn returns false. With an ordered index (see EnableOrderedIndex) it
+// costs a binary search plus the keys visited, amortised over the insertions
+// since the previous call; without one it scans and sorts the whole table.
+// The table must not be modified during the iteration, and as RangeKeys may
+// reorganise the index it must not run concurrently with other readers
+// either. On a snapshot it leaves the shared index untouched and is safe for
+// concurrent use.
+func (ht *ElasticHashTable) RangeKeys(lo, hi int, fn func(key int) bool) {
+	rangeKeys(ht.index, !ht.readOnly, ht.Contains, ht.Range, lo, hi, fn)
+}
+
+// indexAdd records an inserted key in the ordered index, if any.
+func (ht *ElasticHashTable) indexAdd(key int) {
+	if ht.index != nil {
+		ht.index.add(key, ht.Contains)
+	}
+}
+
+// indexRemove records a removed key in the ordered index, if any.
+func (ht *ElasticHashTable) indexRemove(key int) {
+	if ht.index != nil {
+		ht.index.remove(key, ht.Contains)
+	}
+}
+
+// EnableOrderedIndex attaches an ordered index of the keys, see
+// ElasticHashTable.EnableOrderedIndex.
+func (ht *FunnelHashTable) EnableOrderedIndex() {
+	ht.index = newOrderedIndex(ht.Range)
+}
+
+// DisableOrderedIndex detaches the ordered index.
+func (ht *FunnelHashTable) DisableOrderedIndex() {
+	ht.index = nil
+}
+
+// RangeKeys calls fn in ascending order for every key k with lo <= k <= hi,
+// until fn returns false, see ElasticHashTable.RangeKeys.
+func (ht *FunnelHashTable) RangeKeys(lo, hi int, fn func(key int) bool) {
+	rangeKeys(ht.index, !ht.readOnly, ht.Contains, ht.Range, lo, hi, fn)
+}
+
+// indexAdd records an inserted key in the ordered index, if any.
+func (ht *FunnelHashTable) indexAdd(key int) {
+	if ht.index != nil {
+		ht.index.add(key, ht.Contains)
+	}
+}
+
+// indexRemove records a removed key in the ordered index, if any.
+func (ht *FunnelHashTable) indexRemove(key int) {
+	if ht.index != nil {
+		ht.index.remove(key, ht.Contains)
+	}
+}
@@ -0,0 +1,190 @@
+package elastichash
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func collectRange(ht testTable, lo, hi int) []int {
+	var keys []int
+	ht.RangeKeys(lo, hi, func(key int) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+func wantRange(set map[int]bool, lo, hi int) []int {
+	var keys []int
+	for key := range set {
+		if key >= lo && key <= hi {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func TestRangeKeys(t *testing.T) {
+	forEachTable[testTable](t, NewElasticHashTable(20000, 0.1), NewFunnelHashTable(20000, 8, 0.1), func(t *testing.T, ht testTable) {
+		rng := rand.New(rand.NewSource(1))
+		set := make(map[int]bool)
+		for len(set) < 2000 {
+			key := rng.Intn(100000)
+			ht.Insert(key)
+			set[key] = true
+		}
+		ht.EnableOrderedIndex()
+
+		// Mixed operations, with scans often enough to exercise both the
+		// sorted tail and the merges
+		for step := 0; step < 20000; step++ {
+			key := rng.Intn(100000)
+			switch op := rng.Intn(10); {
+			case op < 4:
+				if ht.Size() < ht.Capacity()-100 {
+					ht.Insert(key)
+					set[key] = true
+				}
+			case op < 7:
+				ht.Remove(key)
+				delete(set, key)
+			case op < 8:
+				if ok, _ := ht.Replace(key, key+1); ok {
+					delete(set, key)
+					set[key+1] = true
+				}
+			case op < 9:
+				batch := []int{key, key + 3, key}
+				if ht.Size() < ht.Capacity()-100 && ht.InsertBatch(batch) == nil {
+					set[key], set[key+3] = true, true
+				}
+			default:
+				batch := []int{key, key + 1, key + 2}
+				ht.RemoveBatch(batch)
+				for _, k := range batch {
+					delete(set, k)
+				}
+			}
+			if step%97 == 0 {
+				lo := rng.Intn(100000)
+				hi := lo + rng.Intn(5000)
+				if got, want := collectRange(ht, lo, hi), wantRange(set, lo, hi); !slices.Equal(got, want) {
+					t.Fatalf("Step %d: RangeKeys(%d, %d) = %v, want %v", step, lo, hi, got, want)
+				}
+			}
+		}
+		if got, want := collectRange(ht, 0, 1<<40), wantRange(set, 0, 1<<40); !slices.Equal(got, want) {
+			t.Fatalf("Full range: %d keys, want %d", len(got), len(want))
+		}
+		if got := collectRange(ht, 10, 9); got != nil {
+			t.Errorf("Empty range returned %v", got)
+		}
+
+		// Early stop
+		n := 0
+		ht.RangeKeys(0, 1<<40, func(int) bool {
+			n++
+			return n < 5
+		})
+		if n != 5 {
+			t.Errorf("Iteration continued after fn returned false: %d calls", n)
+		}
+	})
+}
+
+func TestRangeKeysWithoutIndex(t *testing.T) {
+	ht := NewFunnelHashTable(1000, 4, 0.1)
+	for k := 0; k < 500; k++ {
+		ht.Insert(k * 7 % 1000)
+	}
+	set := make(map[int]bool)
+	ht.Range(func(key int) bool {
+		set[key] = true
+		return true
+	})
+	if got, want := collectRange(ht, 100, 300), wantRange(set, 100, 300); !slices.Equal(got, want) {
+		t.Errorf("RangeKeys without index = %v, want %v", got, want)
+	}
+	ht.EnableOrderedIndex()
+	ht.DisableOrderedIndex()
+	ht.Remove(105)
+	delete(set, 105)
+	if got, want := collectRange(ht, 100, 300), wantRange(set, 100, 300); !slices.Equal(got, want) {
+		t.Errorf("RangeKeys after DisableOrderedIndex = %v, want %v", got, want)
+	}
+}
+
+func TestRangeKeysSnapshot(t *testing.T) {
+	ht := NewElasticHashTable(4000, 0.1)
+	ht.EnableOrderedIndex()
+	for k := 0; k < 1000; k++ {
+		ht.Insert(k)
+	}
+	ht.Remove(10)
+	snap := ht.Snapshot()
+	for k := 1000; k < 3000; k++ {
+		ht.Insert(k)
+	}
+	for k := 0; k < 500; k++ {
+		ht.Remove(k)
+	}
+
+	want := make(map[int]bool)
+	for k := 0; k < 1000; k++ {
+		want[k] = true
+	}
+	delete(want, 10)
+	if got := collectRange(snap, 0, 5000); !slices.Equal(got, wantRange(want, 0, 5000)) {
+		t.Errorf("Snapshot sees %d keys, want %d", len(got), len(want))
+	}
+	if got := collectRange(ht, 0, 5000); len(got) != 2500 || got[0] != 500 || got[len(got)-1] != 2999 {
+		t.Errorf("Table sees %d keys from %v", len(got), got[:1])
+	}
+}
+
+func TestOrderedIndexBounded(t *testing.T) {
+	// Churn without any scan must not let the index grow without bound
+	ht := NewFunnelHashTable(1000, 8, 0.1)
+	ht.EnableOrderedIndex()
+	for k := 0; k < 200000; k++ {
+		ht.Insert(k)
+		ht.Remove(k)
+	}
+	if n := len(ht.index.run) + len(ht.index.added.keys) + len(ht.index.removed.keys); n > minLog*16 {
+		t.Errorf("Index holds %d keys for an empty table", n)
+	}
+	if got := collectRange(ht, 0, 1<<40); got != nil {
+		t.Errorf("Empty table returned %v", got)
+	}
+}
+
+// BenchmarkRangeKeys scans ranges of 100 keys in a table of a million keys,
+// with and without the ordered index, and with an insertion between scans.
+func BenchmarkRangeKeys(b *testing.B) {
+	const n = 1 << 20
+	ht := NewFunnelHashTable(n*10/9+1, 8, 0.1)
+	for k := 0; k < n-1000; k++ {
+		ht.Insert(k * 16)
+	}
+	scan := func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			lo := (i * 7919 % (n - 100)) * 16
+			ht.RangeKeys(lo, lo+100*16, func(int) bool { return true })
+		}
+	}
+	b.Run("Scan", scan)
+	ht.EnableOrderedIndex()
+	b.Run("Index", scan)
+	b.Run("IndexInsert", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			key := i*16 + 1
+			if ht.Insert(key) == nil {
+				ht.Remove(key - 16*7)
+			}
+			lo := (i * 7919 % (n - 100)) * 16
+			ht.RangeKeys(lo, lo+100*16, func(int) bool { return true })
+		}
+	})
+}
@@ -0,0 +1,85 @@
+//go:build linux
+
+package elastichash
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// MapMode selects how a memory-mapped table may be modified.
+type MapMode int
+
+const (
+	// MapReadOnly maps the file read-only. Insert returns an error and Remove
+	// reports false; lookups work directly on the mapped pages.
+	MapReadOnly MapMode = iota
+	// MapCopyOnWrite maps the file privately. Mutations are allowed and
+	// only touched pages are copied; the file itself is never modified.
+	MapCopyOnWrite
+)
+
+// OpenElasticHashTable maps a file written from ElasticHashTable.MarshalBinary
+// and returns a table whose levels alias the mapping, so lookups work without
+// reading or copying the file. Call Close to unmap it.
+func OpenElasticHashTable(path string, mode MapMode) (*ElasticHashTable, error) {
+	data, unmap, err := mapFile(path, mode)
+	if err != nil {
+		return nil, err
+	}
+	ht, err := decodeElastic(data, true)
+	if err != nil {
+		unmap()
+		return nil, err
+	}
+	ht.readOnly = mode == MapReadOnly
+	ht.release = unmap
+	return ht, nil
+}
+
+// OpenFunnelHashTable maps a file written from FunnelHashTable.MarshalBinary,
+// see OpenElasticHashTable.
+func OpenFunnelHashTable(path string, mode MapMode) (*FunnelHashTable, error) {
+	data, unmap, err := mapFile(path, mode)
+	if err != nil {
+		return nil, err
+	}
+	ht, err := decodeFunnel(data, true)
+	if err != nil {
+		unmap()
+		return nil, err
+	}
+	ht.readOnly = mode == MapReadOnly
+	ht.release = unmap
+	return ht, nil
+}
+
+func mapFile(path string, mode MapMode) ([]byte, func() error, error) {
+	if !canAlias() {
+		return nil, nil, errors.New("memory-mapped tables require a 64-bit little-endian platform")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	if st.Size() < wordSize || int64(int(st.Size())) != st.Size() {
+		return nil, nil, errCorrupt
+	}
+
+	prot, flags := syscall.PROT_READ, syscall.MAP_SHARED
+	if mode == MapCopyOnWrite {
+		prot, flags = syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(st.Size()), prot, flags)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
@@ -0,0 +1,104 @@
+//go:build linux
+
+package elastichash
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMappedTables(t *testing.T) {
+	dir := t.TempDir()
+
+	eht := NewElasticHashTable(1000, 0.1)
+	fht := NewFunnelHashTable(1000, 8, 0.1)
+	for i := 0; i < 600; i++ {
+		eht.Insert(i * 3)
+		fht.Insert(i * 3)
+	}
+	eht.Remove(0)
+	fht.Remove(0)
+
+	edata, err := eht.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fdata, err := fht.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	epath := filepath.Join(dir, "elastic.bin")
+	fpath := filepath.Join(dir, "funnel.bin")
+	if err := os.WriteFile(epath, edata, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fpath, fdata, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Read-only: lookups work, mutations are refused
+	me, err := OpenElasticHashTable(epath, MapReadOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mf, err := OpenFunnelHashTable(fpath, MapReadOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if me.Size() != eht.Size() || mf.Size() != fht.Size() {
+		t.Errorf("Mapped sizes %d/%d, expected %d/%d", me.Size(), mf.Size(), eht.Size(), fht.Size())
+	}
+	for i := 0; i < 1800; i++ {
+		expected := i%3 == 0 && i != 0
+		if me.Contains(i) != expected {
+			t.Errorf("Mapped elastic Contains(%d) should be %v", i, expected)
+		}
+		if mf.Contains(i) != expected {
+			t.Errorf("Mapped funnel Contains(%d) should be %v", i, expected)
+		}
+	}
+	if me.Insert(1) == nil || mf.Insert(1) == nil {
+		t.Errorf("Insert into a read-only mapping should fail")
+	}
+	if me.Remove(3) || mf.Remove(3) {
+		t.Errorf("Remove from a read-only mapping should report false")
+	}
+	if err := me.Close(); err != nil {
+		t.Error(err)
+	}
+	if err := mf.Close(); err != nil {
+		t.Error(err)
+	}
+
+	// Copy-on-write: mutations are visible in the table but not in the file
+	ce, err := OpenElasticHashTable(epath, MapCopyOnWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ce.Close()
+	if err := ce.Insert(1); err != nil || !ce.Contains(1) {
+		t.Errorf("Insert into a copy-on-write mapping failed: %v", err)
+	}
+	if !ce.Remove(3) || ce.Contains(3) {
+		t.Errorf("Remove from a copy-on-write mapping failed")
+	}
+	onDisk, err := os.ReadFile(epath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(onDisk) != string(edata) {
+		t.Errorf("Copy-on-write mutations must not reach the file")
+	}
+
+	// Corrupt files are rejected
+	if err := os.WriteFile(epath, edata[:len(edata)/2], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenElasticHashTable(epath, MapReadOnly); err == nil {
+		t.Errorf("Opening a truncated snapshot should fail")
+	}
+	if _, err := OpenElasticHashTable(fpath, MapReadOnly); err == nil {
+		t.Errorf("Opening a funnel snapshot as elastic should fail")
+	}
+}
@@ -0,0 +1,28 @@
+package elastichash
+
+// offHeapSlots returns EMPTY-filled slot arrays of the given lengths, carved
+// out of a single anonymous memory mapping outside the Go heap (see mapAnon).
+// Every array starts on a cache line. The garbage collector neither scans
+// nor frees the mapping: release unmaps it, after which none of the arrays
+// may be used.
+func offHeapSlots(lengths []int) (slots [][]int, release func() error, err error) {
+	total := 0
+	for _, n := range lengths {
+		total += (n + slotsPerLine - 1) / slotsPerLine * slotsPerLine
+	}
+	buf, release, err := mapAnon(total)
+	if err != nil {
+		return nil, nil, err
+	}
+	slots = make([][]int, len(lengths))
+	off := 0
+	for i, n := range lengths {
+		s := buf[off : off+n : off+n]
+		for j := range s {
+			s[j] = EMPTY
+		}
+		slots[i] = s
+		off += (n + slotsPerLine - 1) / slotsPerLine * slotsPerLine
+	}
+	return slots, release, nil
+}
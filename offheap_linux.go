@@ -0,0 +1,44 @@
+//go:build linux
+
+package elastichash
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// hugePageSize is the size of a transparent huge page on common Linux
+// platforms.
+const hugePageSize = 2 << 20
+
+// mapAnon maps n slots of anonymous memory. Mappings of a huge page or more
+// start on a huge page boundary and are marked MADV_HUGEPAGE, so that the
+// kernel backs them with huge pages and lookups in large tables miss the TLB
+// less often. The hint is best effort: without transparent huge pages the
+// mapping simply uses regular pages.
+func mapAnon(n int) ([]int, func() error, error) {
+	size := n * int(unsafe.Sizeof(int(0)))
+	if size < hugePageSize {
+		if size == 0 {
+			size = 1
+		}
+		data, err := syscall.Mmap(-1, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE|syscall.MAP_ANON)
+		if err != nil {
+			return nil, nil, err
+		}
+		return unsafe.Slice((*int)(unsafe.Pointer(&data[0])), n), func() error { return syscall.Munmap(data) }, nil
+	}
+
+	// Over-allocate by a huge page to align the start. The slack is never
+	// touched, so it costs address space only.
+	data, err := syscall.Mmap(-1, 0, size+hugePageSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE|syscall.MAP_ANON)
+	if err != nil {
+		return nil, nil, err
+	}
+	off := 0
+	if rem := int(uintptr(unsafe.Pointer(&data[0])) % hugePageSize); rem != 0 {
+		off = hugePageSize - rem
+	}
+	syscall.Madvise(data[off:off+size], syscall.MADV_HUGEPAGE)
+	return unsafe.Slice((*int)(unsafe.Pointer(&data[off])), n), func() error { return syscall.Munmap(data) }, nil
+}
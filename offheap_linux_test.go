@@ -0,0 +1,21 @@
+//go:build linux
+
+package elastichash
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestOffHeapHugePageAlignment(t *testing.T) {
+	ht := NewFunnelHashTableWithOptions(1<<20, 8, 0.1, FunnelOptions{OffHeap: true})
+	defer ht.Close()
+	if p := uintptr(unsafe.Pointer(&ht.levels[0].slots[0])); p%hugePageSize != 0 {
+		t.Errorf("Large off-heap mapping at %#x does not start on a huge page", p)
+	}
+	for i, lvl := range ht.levels {
+		if p := uintptr(unsafe.Pointer(&lvl.slots[0])); p%cacheLineSize != 0 {
+			t.Errorf("Level %d at %#x does not start on a cache line", i, p)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package elastichash
+
+// mapAnon falls back to the Go heap where anonymous mappings are not
+// supported, so off-heap tables still work, as regular tables.
+func mapAnon(n int) ([]int, func() error, error) {
+	return alignedSlots(n), func() error { return nil }, nil
+}
@@ -0,0 +1,34 @@
+package elastichash
+
+import "testing"
+
+func TestOffHeapTables(t *testing.T) {
+	const N = 1 << 19 // 4 MiB of slots, large enough for huge pages
+	eht := NewElasticHashTableWithOptions(N, 0.1, ElasticOptions{OffHeap: true})
+	fht := NewFunnelHashTableWithOptions(N, 6, 0.1, FunnelOptions{OffHeap: true, Aligned: true})
+	forEachTable[testTable](t, eht, fht, func(t *testing.T, ht testTable) {
+		for k := 0; k < 100000; k++ {
+			if err := ht.Insert(k * 5); err != nil {
+				t.Fatalf("Insert(%d): %v", k*5, err)
+			}
+		}
+		for k := 0; k < 100000; k++ {
+			if !ht.Contains(k * 5) {
+				t.Fatalf("Key %d missing", k*5)
+			}
+		}
+		if ht.Contains(1) || !ht.Remove(5) || ht.Contains(5) {
+			t.Errorf("Lookups or removal failed on off-heap slots")
+		}
+
+		if err := ht.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+		if ht.Size() != 0 || ht.Contains(10) {
+			t.Errorf("Closed table still reports keys")
+		}
+		if err := ht.Close(); err != nil {
+			t.Errorf("Second Close: %v", err)
+		}
+	})
+}
@@ -0,0 +1,390 @@
+package elastichash
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SyncPolicy controls when a PersistentTable fsyncs its write-ahead log.
+type SyncPolicy int
+
+const (
+	// SyncAlways fsyncs after every logged operation. An operation that
+	// returned successfully survives a crash.
+	SyncAlways SyncPolicy = iota
+	// SyncInterval fsyncs at most once per PersistOptions.SyncInterval, so a
+	// crash can lose the operations logged since the last sync.
+	SyncInterval
+	// SyncNever leaves flushing to the operating system. The log is only
+	// synced by Sync, Checkpoint and Close.
+	SyncNever
+)
+
+// PersistOptions configures a PersistentTable. The zero value syncs every
+// operation and never checkpoints automatically.
+type PersistOptions struct {
+	Sync         SyncPolicy
+	SyncInterval time.Duration // used with SyncInterval, defaults to one second
+	// CheckpointEvery triggers a checkpoint once that many operations have
+	// been logged since the previous one. Zero disables automatic checkpoints.
+	CheckpointEvery int
+}
+
+const (
+	checkpointFile = "checkpoint"
+	walFile        = "wal"
+	walMagic       = 0x3130304c41574845 // "EHWAL001" read as a little-endian word
+	walHeaderSize  = 16                 // magic, generation
+	walRecordSize  = 13                 // op, key, crc32
+
+	walInsert = 1
+	walRemove = 2
+)
+
+// PersistentTable wraps an ElasticHashTable or FunnelHashTable so that it
+// survives crashes. Every successful Insert or Remove that changes the set is
+// appended to a write-ahead log; Checkpoint writes a binary snapshot of the
+// whole table and starts a new log. Opening the directory loads the last
+// checkpoint and replays the log written after it.
+//
+// The log and the checkpoint carry a generation number. A log whose
+// generation is older than the checkpoint was superseded by it (the process
+// stopped between writing the checkpoint and resetting the log) and is
+// discarded on open. A log that ends in a partial or corrupt record is
+// truncated to the last complete record.
+type PersistentTable struct {
+	mu       sync.RWMutex
+	dir      string
+	opts     PersistOptions
+	table    Table
+	wal      *os.File
+	gen      uint64
+	logged   int       // operations logged since the last checkpoint
+	lastSync time.Time // for SyncInterval
+	err      error     // sticky log failure, see Remove
+}
+
+// OpenPersistentTable opens or creates a persistent table in dir. create is
+// called to build an empty table when dir holds no checkpoint yet; it must
+// return an *ElasticHashTable or *FunnelHashTable. A nil opts uses the
+// defaults.
+func OpenPersistentTable(dir string, create func() Table, opts *PersistOptions) (*PersistentTable, error) {
+	pt := &PersistentTable{dir: dir}
+	if opts != nil {
+		pt.opts = *opts
+	}
+	if pt.opts.SyncInterval <= 0 {
+		pt.opts.SyncInterval = time.Second
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, checkpointFile))
+	switch {
+	case err == nil:
+		if len(data) < wordSize {
+			return nil, errCorrupt
+		}
+		pt.gen = binary.LittleEndian.Uint64(data)
+		if pt.table, err = decodeTable(data[wordSize:]); err != nil {
+			return nil, err
+		}
+	case errors.Is(err, os.ErrNotExist):
+		pt.table = create()
+		if _, ok := pt.table.(encoding.BinaryMarshaler); !ok {
+			return nil, errors.New("persistent table requires an ElasticHashTable or FunnelHashTable")
+		}
+	default:
+		return nil, err
+	}
+
+	if err := pt.replay(); err != nil {
+		return nil, err
+	}
+	return pt, nil
+}
+
+// replay applies the log records written after the loaded checkpoint and
+// leaves pt.wal open for appending.
+func (pt *PersistentTable) replay() error {
+	path := filepath.Join(pt.dir, walFile)
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if len(data) < walHeaderSize ||
+		binary.LittleEndian.Uint64(data) != walMagic ||
+		binary.LittleEndian.Uint64(data[8:]) != pt.gen {
+		// Missing, torn while being created, or superseded by the checkpoint
+		return pt.resetLog()
+	}
+
+	valid := walHeaderSize
+	for ; len(data)-valid >= walRecordSize; valid += walRecordSize {
+		rec := data[valid : valid+walRecordSize]
+		if crc32.ChecksumIEEE(rec[:9]) != binary.LittleEndian.Uint32(rec[9:]) {
+			break
+		}
+		key := int(int64(binary.LittleEndian.Uint64(rec[1:])))
+		switch rec[0] {
+		case walInsert:
+			if err := pt.table.Insert(key); err != nil {
+				return err
+			}
+		case walRemove:
+			pt.table.Remove(key)
+		}
+		pt.logged++
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	if valid < len(data) {
+		// Drop the torn tail so new records follow the last good one
+		if err := f.Truncate(int64(valid)); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if _, err := f.Seek(int64(valid), io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+	pt.wal = f
+	return nil
+}
+
+// resetLog atomically replaces the log with an empty one for pt.gen.
+func (pt *PersistentTable) resetLog() error {
+	if pt.wal != nil {
+		pt.wal.Close()
+		pt.wal = nil
+	}
+	var hdr [walHeaderSize]byte
+	binary.LittleEndian.PutUint64(hdr[:], walMagic)
+	binary.LittleEndian.PutUint64(hdr[8:], pt.gen)
+	path := filepath.Join(pt.dir, walFile)
+	if err := writeFileSync(path, hdr[:]); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	pt.wal = f
+	pt.logged = 0
+	return nil
+}
+
+// Insert adds key to the table and logs it. If the record cannot be
+// written, the insertion is undone; any log failure is kept and returned by
+// every later Insert, Sync or Checkpoint.
+func (pt *PersistentTable) Insert(key int) error {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	if pt.wal == nil {
+		return os.ErrClosed
+	}
+	if pt.err != nil {
+		return pt.err
+	}
+	before := pt.table.Size()
+	if err := pt.table.Insert(key); err != nil {
+		return err
+	}
+	if pt.table.Size() == before {
+		return nil // already present, nothing to log
+	}
+	written, err := pt.log(walInsert, key)
+	if !written {
+		pt.table.Remove(key)
+	}
+	return err
+}
+
+// Remove deletes key from the table and logs it, reporting whether the key
+// was removed. Remove cannot return an error: after a log failure it removes
+// nothing and returns false, and if its own record cannot be written the key
+// is put back. The failure is kept and returned by every later Insert, Sync
+// or Checkpoint.
+func (pt *PersistentTable) Remove(key int) bool {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	if pt.wal == nil || pt.err != nil || !pt.table.Remove(key) {
+		return false
+	}
+	if written, _ := pt.log(walRemove, key); !written {
+		pt.table.Insert(key)
+		return false
+	}
+	return true
+}
+
+// Contains reports whether key is in the table.
+func (pt *PersistentTable) Contains(key int) bool {
+	pt.mu.RLock()
+	defer pt.mu.RUnlock()
+	return pt.table.Contains(key)
+}
+
+// Size returns the number of keys in the table.
+func (pt *PersistentTable) Size() int {
+	pt.mu.RLock()
+	defer pt.mu.RUnlock()
+	return pt.table.Size()
+}
+
+// Capacity returns the maximum number of keys the table can hold.
+func (pt *PersistentTable) Capacity() int {
+	pt.mu.RLock()
+	defer pt.mu.RUnlock()
+	return pt.table.Capacity()
+}
+
+// Range calls fn for every key in the table until fn returns false. The
+// table is locked for reading meanwhile, so fn must not modify it.
+func (pt *PersistentTable) Range(fn func(key int) bool) {
+	pt.mu.RLock()
+	defer pt.mu.RUnlock()
+	pt.table.Range(fn)
+}
+
+// log appends one record and applies the sync and checkpoint policies. It
+// reports whether the record reached the log, even if a later step failed;
+// a record that was not written leaves at most a torn tail, which the next
+// open drops. Any error is kept in pt.err. Caller holds pt.mu.
+func (pt *PersistentTable) log(op byte, key int) (written bool, err error) {
+	if pt.err != nil {
+		return false, pt.err
+	}
+	if pt.wal == nil {
+		return false, os.ErrClosed
+	}
+	defer func() { pt.err = err }()
+
+	var rec [walRecordSize]byte
+	rec[0] = op
+	binary.LittleEndian.PutUint64(rec[1:], uint64(int64(key)))
+	binary.LittleEndian.PutUint32(rec[9:], crc32.ChecksumIEEE(rec[:9]))
+	if _, err := pt.wal.Write(rec[:]); err != nil {
+		return false, err
+	}
+	pt.logged++
+
+	switch pt.opts.Sync {
+	case SyncAlways:
+		if err := pt.wal.Sync(); err != nil {
+			return true, err
+		}
+	case SyncInterval:
+		if now := time.Now(); now.Sub(pt.lastSync) >= pt.opts.SyncInterval {
+			if err := pt.wal.Sync(); err != nil {
+				return true, err
+			}
+			pt.lastSync = now
+		}
+	}
+
+	if pt.opts.CheckpointEvery > 0 && pt.logged >= pt.opts.CheckpointEvery {
+		return true, pt.checkpoint()
+	}
+	return true, nil
+}
+
+// Sync flushes the log to stable storage.
+func (pt *PersistentTable) Sync() error {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	if pt.wal == nil {
+		return os.ErrClosed
+	}
+	if pt.err != nil {
+		return pt.err
+	}
+	return pt.wal.Sync()
+}
+
+// Checkpoint writes a snapshot of the table and starts a new, empty log.
+func (pt *PersistentTable) Checkpoint() error {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	if pt.wal == nil {
+		return os.ErrClosed
+	}
+	if pt.err != nil {
+		return pt.err
+	}
+	return pt.checkpoint()
+}
+
+func (pt *PersistentTable) checkpoint() error {
+	snap, err := pt.table.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return err
+	}
+	data := make([]byte, wordSize, wordSize+len(snap))
+	binary.LittleEndian.PutUint64(data, pt.gen+1)
+	data = append(data, snap...)
+	if err := writeFileSync(filepath.Join(pt.dir, checkpointFile), data); err != nil {
+		return err
+	}
+	// From here on the old log is stale; if we stop before resetting it,
+	// the generation mismatch makes the next open discard it.
+	pt.gen++
+	return pt.resetLog()
+}
+
+// Close syncs and closes the log. The table must not be used afterwards.
+func (pt *PersistentTable) Close() error {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	if pt.wal == nil {
+		return nil
+	}
+	err := pt.wal.Sync()
+	if cerr := pt.wal.Close(); err == nil {
+		err = cerr
+	}
+	pt.wal = nil
+	return err
+}
+
+// writeFileSync atomically replaces path with data: it writes a temporary
+// file, fsyncs it, renames it into place and fsyncs the directory.
+func writeFileSync(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	d, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
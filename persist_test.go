@@ -0,0 +1,190 @@
+package elastichash
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPersistentTableRecovery(t *testing.T) {
+	newElastic := func() Table { return NewElasticHashTable(1000, 0.1) }
+	newFunnel := func() Table { return NewFunnelHashTable(1000, 8, 0.1) }
+	forEachTable(t, newElastic, newFunnel, func(t *testing.T, create func() Table) {
+		dir := t.TempDir()
+		pt, err := OpenPersistentTable(dir, create, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 100; i++ {
+			if err := pt.Insert(i); err != nil {
+				t.Fatal(err)
+			}
+		}
+		pt.Remove(10)
+		pt.Insert(5) // duplicate, not logged
+		if err := pt.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Replay the log alone
+		pt, err = OpenPersistentTable(dir, create, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pt.Size() != 99 || pt.Contains(10) || !pt.Contains(99) {
+			t.Errorf("After replay: size %d, Contains(10)=%v, Contains(99)=%v", pt.Size(), pt.Contains(10), pt.Contains(99))
+		}
+
+		// Checkpoint, then log more on top of it
+		if err := pt.Checkpoint(); err != nil {
+			t.Fatal(err)
+		}
+		pt.Insert(1000)
+		pt.Remove(20)
+		pt.Close()
+
+		pt, err = OpenPersistentTable(dir, create, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pt.Size() != 99 || !pt.Contains(1000) || pt.Contains(20) {
+			t.Errorf("After checkpoint and replay: size %d, Contains(1000)=%v, Contains(20)=%v", pt.Size(), pt.Contains(1000), pt.Contains(20))
+		}
+		pt.Close()
+
+		// Truncated log: the torn last record is dropped, the rest kept
+		walPath := filepath.Join(dir, walFile)
+		data, _ := os.ReadFile(walPath)
+		if err := os.WriteFile(walPath, data[:len(data)-5], 0o644); err != nil {
+			t.Fatal(err)
+		}
+		pt, err = OpenPersistentTable(dir, create, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pt.Contains(1000) || !pt.Contains(20) {
+			t.Errorf("Torn record should be dropped: Contains(1000)=%v, Contains(20)=%v", pt.Contains(1000), pt.Contains(20))
+		}
+		// Appends after recovery start at the last complete record
+		pt.Insert(2000)
+		pt.Close()
+		pt, err = OpenPersistentTable(dir, create, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pt.Contains(1000) || !pt.Contains(2000) || pt.Size() != 101 {
+			t.Errorf("Append after recovery lost: size %d, Contains(2000)=%v", pt.Size(), pt.Contains(2000))
+		}
+		pt.Close()
+
+		// Corrupt record: replay stops before it
+		data, _ = os.ReadFile(walPath)
+		data[walHeaderSize+1] ^= 0xff
+		os.WriteFile(walPath, data, 0o644)
+		pt, err = OpenPersistentTable(dir, create, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pt.Contains(1000) || pt.Contains(2000) || pt.Size() != 99 {
+			t.Errorf("Records after corruption should be dropped: size %d", pt.Size())
+		}
+		pt.Close()
+
+		// A log from an older generation than the checkpoint is ignored,
+		// as after a crash between writing a checkpoint and resetting the log
+		pt, err = OpenPersistentTable(dir, create, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pt.Insert(3000)
+		staleLog, _ := os.ReadFile(walPath)
+		pt.Checkpoint()
+		pt.Remove(3000)
+		pt.Checkpoint()
+		pt.Close()
+		os.WriteFile(walPath, staleLog, 0o644)
+		pt, err = OpenPersistentTable(dir, create, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pt.Size() != 99 || pt.Contains(3000) {
+			t.Errorf("Stale log should be discarded: size %d, Contains(3000)=%v", pt.Size(), pt.Contains(3000))
+		}
+		pt.Close()
+	})
+}
+
+func TestPersistentTableAutoCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	create := func() Table { return NewFunnelHashTable(200, 4, 0.2) }
+	pt, err := OpenPersistentTable(dir, create, &PersistOptions{Sync: SyncNever, CheckpointEvery: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 25; i++ {
+		pt.Insert(i)
+	}
+	pt.Close()
+
+	data, err := os.ReadFile(filepath.Join(dir, walFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := (len(data) - walHeaderSize) / walRecordSize; n != 5 {
+		t.Errorf("Expected 5 records after the last checkpoint, got %d", n)
+	}
+	pt, err = OpenPersistentTable(dir, create, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pt.Close()
+	if pt.Size() != 25 {
+		t.Errorf("Expected size 25 after reopen, got %d", pt.Size())
+	}
+}
+
+func TestPersistentTableLogFailure(t *testing.T) {
+	dir := t.TempDir()
+	create := func() Table { return NewElasticHashTable(200, 0.1) }
+	pt, err := OpenPersistentTable(dir, create, &PersistOptions{Sync: SyncNever})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pt.Insert(1)
+	pt.Insert(2)
+	pt.wal.Close() // every later write fails
+
+	if err := pt.Insert(3); err == nil || pt.Contains(3) {
+		t.Errorf("Insert with a failing log: err %v, key kept %v", err, pt.Contains(3))
+	}
+	if pt.Remove(1) || !pt.Contains(1) {
+		t.Errorf("Remove after a log failure changed the table")
+	}
+	if err := pt.Insert(4); err == nil || pt.Contains(4) {
+		t.Errorf("Insert after a log failure: err %v, key kept %v", err, pt.Contains(4))
+	}
+	pt.Close()
+
+	pt, err = OpenPersistentTable(dir, create, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pt.Close()
+	if pt.Size() != 2 || !pt.Contains(1) || !pt.Contains(2) {
+		t.Errorf("Reopened table has %d keys, want 1 and 2", pt.Size())
+	}
+}
+
+func TestPersistentTableRemoveRollback(t *testing.T) {
+	dir := t.TempDir()
+	pt, err := OpenPersistentTable(dir, func() Table { return NewFunnelHashTable(200, 4, 0.1) }, &PersistOptions{Sync: SyncNever})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pt.Close()
+	pt.Insert(7)
+	pt.wal.Close()
+	if pt.Remove(7) || !pt.Contains(7) || pt.Size() != 1 {
+		t.Errorf("Remove whose record was not written should leave the key")
+	}
+}
@@ -0,0 +1,152 @@
+package elastichash
+
+import "math/bits"
+
+// bloomFilter is a blocked Bloom filter: each key sets and tests k bits
+// within a single 512-bit block, so a lookup touches one cache line.
+type bloomFilter struct {
+	blocks []uint64 // 8 words per block
+	k      int
+}
+
+// defaultBitsPerKey gives a false positive rate of roughly 1-2%.
+const defaultBitsPerKey = 10
+
+func newBloomFilter(n int, bitsPerKey int) *bloomFilter {
+	if bitsPerKey <= 0 {
+		bitsPerKey = defaultBitsPerKey
+	}
+	if n < 1 {
+		n = 1
+	}
+	numBlocks := (n*bitsPerKey + 511) / 512
+	// ln(2) * bits per key is optimal; blocking favours slightly fewer probes
+	k := bitsPerKey * 6 / 10
+	if k < 1 {
+		k = 1
+	}
+	if k > 7 {
+		k = 7 // 7 probes of 9 bits use 63 bits of the second hash
+	}
+	return &bloomFilter{blocks: make([]uint64, numBlocks*8), k: k}
+}
+
+// bloomHash mixes key with its own constants, independent of the table hashes.
+func bloomHash(key int) (block, bitsel uint64) {
+	x := uint64(key) ^ 0x6A09E667F3BCC909
+	x = (x ^ (x >> 33)) * 0xFF51AFD7ED558CCD
+	x = (x ^ (x >> 33)) * 0xC4CEB9FE1A85EC53
+	x ^= x >> 33
+	return x, x*0x9E3779B97F4A7C15 | 1
+}
+
+func (f *bloomFilter) add(key int) {
+	h, sel := bloomHash(key)
+	b, _ := bits.Mul64(h, uint64(len(f.blocks)/8))
+	block := f.blocks[b*8 : b*8+8]
+	for i := 0; i < f.k; i++ {
+		bit := sel >> (9 * i) & 511
+		block[bit>>6] |= 1 << (bit & 63)
+	}
+}
+
+func (f *bloomFilter) clone() *bloomFilter {
+	return &bloomFilter{blocks: append([]uint64(nil), f.blocks...), k: f.k}
+}
+
+func (f *bloomFilter) mayContain(key int) bool {
+	h, sel := bloomHash(key)
+	b, _ := bits.Mul64(h, uint64(len(f.blocks)/8))
+	block := f.blocks[b*8 : b*8+8]
+	for i := 0; i < f.k; i++ {
+		bit := sel >> (9 * i) & 511
+		if block[bit>>6]&(1<<(bit&63)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// EnablePrefilter attaches a blocked Bloom filter with bitsPerKey bits per
+// key of capacity (zero or less selects 10, about 1% false positives) and
+// loads the current keys into it. Contains then answers most lookups of
+// absent keys from the filter alone, instead of probing every level and
+// scanning the last level up to an EMPTY slot. Insert keeps the filter up to
+// date, and snapshots taken afterwards keep a copy-on-write share of it.
+//
+// Remove cannot clear filter bits, so after many removals the filter lets
+// more absent keys through; RebuildPrefilter restores its accuracy.
+func (ht *ElasticHashTable) EnablePrefilter(bitsPerKey int) {
+	f := newBloomFilter(ht.capacity, bitsPerKey)
+	ht.Range(func(key int) bool {
+		f.add(key)
+		return true
+	})
+	ht.filter = f
+	ht.filterShared = false
+}
+
+// RebuildPrefilter rebuilds the prefilter from the current keys, dropping the
+// bits left behind by removed keys. It does nothing without a prefilter.
+func (ht *ElasticHashTable) RebuildPrefilter() {
+	if ht.filter != nil {
+		ht.EnablePrefilter(len(ht.filter.blocks) * 64 / max(ht.capacity, 1))
+	}
+}
+
+// DisablePrefilter detaches the prefilter.
+func (ht *ElasticHashTable) DisablePrefilter() {
+	ht.filter = nil
+	ht.filterShared = false
+}
+
+// EnablePrefilter attaches a blocked Bloom filter, see
+// ElasticHashTable.EnablePrefilter.
+func (ht *FunnelHashTable) EnablePrefilter(bitsPerKey int) {
+	f := newBloomFilter(ht.capacity, bitsPerKey)
+	ht.Range(func(key int) bool {
+		f.add(key)
+		return true
+	})
+	ht.filter = f
+	ht.filterShared = false
+}
+
+// RebuildPrefilter rebuilds the prefilter from the current keys, see
+// ElasticHashTable.RebuildPrefilter.
+func (ht *FunnelHashTable) RebuildPrefilter() {
+	if ht.filter != nil {
+		ht.EnablePrefilter(len(ht.filter.blocks) * 64 / max(ht.capacity, 1))
+	}
+}
+
+// DisablePrefilter detaches the prefilter.
+func (ht *FunnelHashTable) DisablePrefilter() {
+	ht.filter = nil
+	ht.filterShared = false
+}
+
+// addToFilter records key in the prefilter, if any, copying the filter first
+// when it is still shared with a snapshot.
+func (ht *ElasticHashTable) addToFilter(key int) {
+	if ht.filter == nil {
+		return
+	}
+	if ht.filterShared {
+		ht.filter = ht.filter.clone()
+		ht.filterShared = false
+	}
+	ht.filter.add(key)
+}
+
+// addToFilter records key in the prefilter, see ElasticHashTable.addToFilter.
+func (ht *FunnelHashTable) addToFilter(key int) {
+	if ht.filter == nil {
+		return
+	}
+	if ht.filterShared {
+		ht.filter = ht.filter.clone()
+		ht.filterShared = false
+	}
+	ht.filter.add(key)
+}
@@ -0,0 +1,114 @@
+package elastichash
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPrefilter(t *testing.T) {
+	forEachTable[testTable](t, NewElasticHashTable(10000, 0.1), NewFunnelHashTable(10000, 8, 0.1), func(t *testing.T, ht testTable) {
+		for i := 0; i < 3000; i++ {
+			ht.Insert(i)
+		}
+		// Keys present before the filter is enabled are loaded into it
+		ht.EnablePrefilter(0)
+		for i := 3000; i < 6000; i++ {
+			ht.Insert(i)
+		}
+		batch := make([]int, 1000)
+		for i := range batch {
+			batch[i] = 6000 + i
+		}
+		if err := ht.InsertBatch(batch); err != nil {
+			t.Fatalf("InsertBatch: %v", err)
+		}
+		for i := 0; i < 7000; i++ {
+			if !ht.Contains(i) {
+				t.Fatalf("Key %d missing with prefilter enabled", i)
+			}
+		}
+
+		falsePositives := func() int {
+			n := 0
+			for i := 1_000_000; i < 1_100_000; i++ {
+				if ht.Contains(i) {
+					t.Fatalf("Absent key %d reported present", i)
+				}
+			}
+			f := prefilterOf(ht)
+			for i := 1_000_000; i < 1_100_000; i++ {
+				if f.mayContain(i) {
+					n++
+				}
+			}
+			return n
+		}
+		if fp := falsePositives(); fp > 5000 {
+			t.Errorf("Expected under 5%% false positives, got %d in 100000", fp)
+		}
+
+		// Removed keys leave stale bits until the filter is rebuilt
+		for i := 0; i < 7000; i++ {
+			ht.Remove(i)
+		}
+		stale := falsePositives()
+		ht.RebuildPrefilter()
+		if fp := falsePositives(); fp != 0 {
+			t.Errorf("Empty table's rebuilt filter passed %d keys (was %d before rebuild)", fp, stale)
+		}
+
+		ht.DisablePrefilter()
+		if ht.Contains(5) || ht.Insert(5) != nil || !ht.Contains(5) {
+			t.Errorf("Table misbehaves after DisablePrefilter")
+		}
+	})
+}
+
+func TestPrefilterSnapshot(t *testing.T) {
+	ht := NewElasticHashTable(1000, 0.1)
+	ht.EnablePrefilter(0)
+	ht.Insert(1)
+	snap := ht.Snapshot()
+	ht.Insert(2)
+	if snap.filter == ht.filter {
+		t.Errorf("Insert after Snapshot should copy the shared filter")
+	}
+	if !snap.Contains(1) || snap.Contains(2) || !ht.Contains(2) {
+		t.Errorf("Snapshot and table disagree with their contents")
+	}
+}
+
+func prefilterOf(t Table) *bloomFilter {
+	switch ht := t.(type) {
+	case *ElasticHashTable:
+		return ht.filter
+	case *FunnelHashTable:
+		return ht.filter
+	}
+	return nil
+}
+
+func BenchmarkPrefilterMiss(b *testing.B) {
+	for _, filtered := range []bool{false, true} {
+		for _, tc := range []struct {
+			name string
+			ht   testTable
+		}{
+			{"Elastic", NewElasticHashTable(1<<20, 0.1)},
+			{"Funnel", NewFunnelHashTable(1<<20, 8, 0.1)},
+		} {
+			ht := tc.ht
+			for i := 0; i < ht.Capacity(); i++ {
+				ht.Insert(i)
+			}
+			if filtered {
+				ht.EnablePrefilter(0)
+			}
+			b.Run(fmt.Sprintf("%s/filtered=%v", tc.name, filtered), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					ht.Contains(1<<30 + i)
+				}
+			})
+		}
+	}
+}
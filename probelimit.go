@@ -0,0 +1,58 @@
+package elastichash
+
+// scanBudget returns how many slots of an m-slot linear probing array to
+// scan under limit, where 0 means no limit.
+func scanBudget(limit, m int) int {
+	if limit > 0 && limit < m {
+		return limit
+	}
+	return m
+}
+
+// SetProbeLimit bounds the linear scan of the final level to n slots per
+// insertion; 0 removes the bound. Insert then fails with ErrProbeLimit
+// instead of placing a key more than n slots past its start.
+//
+// When the limit is set on an empty table, or the table has had a limit
+// since it was empty, every key in the final level lies within n slots of
+// its start, so insertions, lookups and removals stop there and every
+// insertion touches at most (L-1)*R + n slots. Otherwise keys placed before
+// the limit may lie further out, and all of them still scan until an EMPTY
+// slot, so the limit bounds where keys go but not the slots touched.
+func (ht *ElasticHashTable) SetProbeLimit(n int) {
+	ht.probeLimit, ht.scanLimit = nextLimits(n, ht.scanLimit, ht.Size())
+}
+
+// ProbeLimit returns the limit set with SetProbeLimit, 0 if none.
+func (ht *ElasticHashTable) ProbeLimit() int {
+	return ht.probeLimit
+}
+
+// SetProbeLimit bounds the linear scan of the special array to n slots per
+// insertion, see ElasticHashTable.SetProbeLimit. On a table limited since it
+// was empty, every insertion then touches at most len(levels)*b + n slots.
+func (ht *FunnelHashTable) SetProbeLimit(n int) {
+	ht.probeLimit, ht.scanLimit = nextLimits(n, ht.scanLimit, ht.Size())
+}
+
+// ProbeLimit returns the limit set with SetProbeLimit, 0 if none.
+func (ht *FunnelHashTable) ProbeLimit() int {
+	return ht.probeLimit
+}
+
+// nextLimits derives the insertion and lookup scan limits after a call to
+// SetProbeLimit(n). Keys placed under an earlier, larger limit stay where
+// they are, so the lookup limit only grows; it becomes known only while the
+// table is empty.
+func nextLimits(n, scanLimit, size int) (probe, scan int) {
+	if n <= 0 {
+		return 0, 0
+	}
+	switch {
+	case size == 0:
+		return n, n
+	case scanLimit > 0:
+		return n, max(scanLimit, n)
+	}
+	return n, 0
+}
@@ -0,0 +1,94 @@
+package elastichash
+
+import (
+	"errors"
+	"testing"
+)
+
+// limitCase exposes the linear probing array of a table and the start slot
+// of a key in it.
+type limitCase struct {
+	name string
+	ht   slotTable
+	set  func(n int)
+	last func() []int
+	home func(key int) int
+}
+
+func TestProbeLimit(t *testing.T) {
+	eht := NewElasticHashTable(4096, 0.02)
+	fht := NewFunnelHashTable(4096, 4, 0.02)
+	for _, tc := range []limitCase{
+		{"Elastic", eht, eht.SetProbeLimit,
+			func() []int { return eht.levels[eht.L-1] },
+			func(key int) int { return eht.hashFunc(key, eht.L-1, 0, len(eht.levels[eht.L-1])) }},
+		{"Funnel", fht, fht.SetProbeLimit,
+			func() []int { return fht.special },
+			fht.specialStart},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			const limit = 4
+			ht := tc.ht
+			tc.set(limit)
+
+			var inserted []int
+			limited := 0
+			for k := 0; ht.Size() < ht.Capacity() && k < 100000; k++ {
+				switch err := ht.Insert(k); {
+				case err == nil:
+					inserted = append(inserted, k)
+				case errors.Is(err, ErrProbeLimit):
+					limited++
+				default:
+					t.Fatalf("Insert(%d): unexpected error %v", k, err)
+				}
+			}
+			if limited == 0 {
+				t.Fatalf("Expected some insertions to hit the probe limit near full load")
+			}
+
+			// Every key of the linear probing array is within limit slots
+			// of its start
+			last := tc.last()
+			for pos, v := range last {
+				if v == EMPTY || v == TOMBSTONE {
+					continue
+				}
+				if d := (pos - tc.home(v) + len(last)) % len(last); d >= limit {
+					t.Errorf("Key %d placed %d slots from its start", v, d)
+				}
+			}
+			for _, k := range inserted {
+				if !ht.Contains(k) {
+					t.Fatalf("Key %d missing", k)
+				}
+			}
+			if !ht.Remove(inserted[len(inserted)-1]) || ht.Contains(inserted[len(inserted)-1]) {
+				t.Errorf("Remove under a probe limit failed")
+			}
+
+			// Lifting the limit lets the remaining keys in
+			tc.set(0)
+			for k := 100000; ht.Size() < ht.Capacity(); k++ {
+				if err := ht.Insert(k); err != nil {
+					t.Fatalf("Insert(%d) without limit: %v", k, err)
+				}
+			}
+		})
+	}
+}
+
+func TestProbeLimitBatch(t *testing.T) {
+	ht := NewFunnelHashTable(1024, 4, 0.02)
+	ht.SetProbeLimit(1)
+	keys := make([]int, ht.Capacity())
+	for i := range keys {
+		keys[i] = i
+	}
+	if err := ht.InsertBatch(keys); !errors.Is(err, ErrProbeLimit) {
+		t.Errorf("Expected a full batch to fail with ErrProbeLimit, got %v", err)
+	}
+	if ht.Size() != 0 {
+		t.Errorf("Failed batch should leave the table empty, size is %d", ht.Size())
+	}
+}
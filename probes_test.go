@@ -0,0 +1,133 @@
+package elastichash
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestElasticProbeCounts(t *testing.T) {
+	for _, R := range []int{1, 2, 4, 16, 17, 32, 64, 100} {
+		t.Run(fmt.Sprintf("R=%d", R), func(t *testing.T) {
+			ht := NewElasticHashTableWithOptions(4000, 0.1, ElasticOptions{Probes: R})
+			if ht.R != R || len(ht.levels[0]) != R {
+				t.Fatalf("Expected R=%d and first level of %d slots, got R=%d, %d slots", R, R, ht.R, len(ht.levels[0]))
+			}
+			for k := 0; ht.Size() < ht.Capacity(); k++ {
+				if err := ht.Insert(k); err != nil {
+					t.Fatalf("Insert(%d): %v", k, err)
+				}
+			}
+			n := ht.Size()
+
+			// Keys in the non-final levels, including positions past the
+			// old 16-slot probe bitmap, must all be found
+			high := 0
+			for i := 0; i < ht.L-1; i++ {
+				for pos, v := range ht.levels[i] {
+					if v == EMPTY || v == TOMBSTONE {
+						continue
+					}
+					if pos >= 16 {
+						high++
+					}
+					if !ht.Contains(v) {
+						t.Errorf("Key %d at level %d slot %d not found", v, i, pos)
+					}
+				}
+			}
+			if R > 16 && high == 0 {
+				t.Errorf("Expected keys beyond slot 16 of the first levels")
+			}
+			for k := 0; k < n; k++ {
+				if !ht.Contains(k) {
+					t.Fatalf("Key %d missing", k)
+				}
+			}
+			for k := 0; k < n; k += 2 {
+				if !ht.Remove(k) {
+					t.Fatalf("Remove(%d) failed", k)
+				}
+			}
+			for k := 0; k < n; k++ {
+				if ht.Contains(k) != (k%2 == 1) {
+					t.Fatalf("Contains(%d) wrong after removals", k)
+				}
+			}
+
+			data, _ := ht.MarshalBinary()
+			var back ElasticHashTable
+			if err := back.UnmarshalBinary(data); err != nil || back.R != R || back.Size() != ht.Size() {
+				t.Errorf("Round trip lost R or keys: %v", err)
+			}
+		})
+	}
+}
+
+func TestProbeSeqFresh(t *testing.T) {
+	ht := NewElasticHashTable(1000, 0.1)
+	seq := ht.probes(1, 0, 2000)
+	for _, pos := range []int{0, 63, 64, 1000, 5} {
+		if !seq.fresh(pos) {
+			t.Errorf("First visit of %d reported as repeat", pos)
+		}
+	}
+	for _, pos := range []int{0, 63, 5} {
+		if seq.fresh(pos) {
+			t.Errorf("Second visit of %d reported as new", pos)
+		}
+	}
+}
+
+func TestPermutedProbes(t *testing.T) {
+	ht := NewElasticHashTableWithOptions(1000, 0.1, ElasticOptions{Probes: 12, Permuted: true})
+	for _, m := range []int{1, 2, 7, 12, 64, 100} {
+		for key := 0; key < 200; key++ {
+			seen := make(map[int]bool)
+			seq := ht.probes(key, 0, m)
+			for attempt := 0; attempt < min(ht.R, m); attempt++ {
+				pos := seq.at(attempt)
+				if pos >= m || seen[pos] {
+					t.Fatalf("m=%d key=%d: position %d out of range or repeated", m, key, pos)
+				}
+				seen[pos] = true
+			}
+			if len(seen) != min(ht.R, m) {
+				t.Fatalf("m=%d key=%d: expected %d probes, got %d", m, key, min(ht.R, m), len(seen))
+			}
+		}
+	}
+
+	for k := 0; ht.Size() < ht.Capacity(); k++ {
+		if err := ht.Insert(k); err != nil {
+			t.Fatalf("Insert(%d): %v", k, err)
+		}
+	}
+	// With fresh slots on every probe the first levels fill up completely
+	for i := 0; i < ht.L-1; i++ {
+		for pos, v := range ht.levels[i] {
+			if v == EMPTY {
+				t.Errorf("Level %d slot %d left empty in a full permuted table", i, pos)
+			}
+		}
+	}
+	for k := 0; k < ht.Size(); k++ {
+		if !ht.Contains(k) {
+			t.Fatalf("Key %d missing", k)
+		}
+	}
+
+	data, _ := ht.MarshalBinary()
+	var back ElasticHashTable
+	if err := back.UnmarshalBinary(data); err != nil || !back.permuted {
+		t.Fatalf("Round trip lost the permuted flag: %v", err)
+	}
+	for k := 0; k < ht.Size(); k++ {
+		if !back.Contains(k) {
+			t.Fatalf("Key %d missing after round trip", k)
+		}
+	}
+	data[2*wordSize] |= 0x80 // unknown flag bit
+	if err := back.UnmarshalBinary(data); err == nil {
+		t.Errorf("Expected unknown flags to be rejected")
+	}
+}
@@ -0,0 +1,137 @@
+package elastichash
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFunnelLayoutExact(t *testing.T) {
+	for _, N := range []int{1000, 4096, 10007, 100000} {
+		for _, delta := range []float64{0.05, 0.2} {
+			buckets, special := funnelLayout(N, 4, delta)
+			total := special
+			for _, numB := range buckets {
+				total += numB * 4
+			}
+			if total != N {
+				t.Errorf("N=%d delta=%v: layout has %d slots", N, delta, total)
+			}
+
+			// Levels take their fraction of N, without rounding to a power of two
+			want := []float64{0.6, 0.25, 0.1}
+			if len(buckets) == 4 {
+				want = []float64{0.5, 0.25, 0.15, 0.05}
+			}
+			for i, numB := range buckets {
+				if wantB := int(want[i]*float64(N)) / 4; numB != wantB {
+					t.Errorf("N=%d delta=%v: level %d has %d buckets, want %d", N, delta, i, numB, wantB)
+				}
+			}
+		}
+	}
+}
+
+func TestRangeReduction(t *testing.T) {
+	// Odd sizes: every index is reachable and none is out of range
+	eht := NewElasticHashTable(100, 0.1)
+	for _, m := range []int{1, 3, 7, 1000003} {
+		seen := make(map[int]bool)
+		for k := 0; k < 20*m && k < 100000; k++ {
+			pos := eht.hashFunc(k, 0, 0, m)
+			if pos < 0 || pos >= m {
+				t.Fatalf("hashFunc(%d) = %d out of [0,%d)", k, pos, m)
+			}
+			seen[pos] = true
+		}
+		if m < 100 && len(seen) != m {
+			t.Errorf("Only %d of %d positions reached", len(seen), m)
+		}
+	}
+
+	forEachTable[testTable](t, NewElasticHashTable(10007, 0.1), NewFunnelHashTable(10007, 4, 0.1), func(t *testing.T, ht testTable) {
+		for k := 0; ht.Size() < ht.Capacity(); k++ {
+			if err := ht.Insert(k * 7919); err != nil {
+				t.Fatalf("Insert: %v", err)
+			}
+		}
+		for k := 0; k < ht.Size(); k++ {
+			if !ht.Contains(k * 7919) {
+				t.Fatalf("Key %d missing", k*7919)
+			}
+		}
+	})
+}
+
+func TestFunnelFillsToCapacity(t *testing.T) {
+	// Levels must hash independently: with correlated buckets the keys that
+	// overflow a full bucket pile into one bucket of the next level, and the
+	// special array runs out long before capacity. Small buckets fill less
+	// evenly, so b=4 gets a little more slack than the 5% special array
+	// leaves at delta=0.02.
+	for _, tc := range []struct {
+		b     int
+		delta float64
+	}{{4, 0.05}, {8, 0.02}, {16, 0.02}} {
+		for _, N := range []int{4096, 100000} {
+			ht := NewFunnelHashTable(N, tc.b, tc.delta)
+			for k := 0; ht.Size() < ht.Capacity(); k++ {
+				if err := ht.Insert(k); err != nil {
+					t.Fatalf("b=%d delta=%v N=%d: %v", tc.b, tc.delta, N, err)
+				}
+			}
+		}
+	}
+}
+
+func TestFunnelFillBeforeFailure(t *testing.T) {
+	// With small buckets the keys overflowing them outgrow the special
+	// array before the table reaches Capacity. Pin how full each
+	// configuration gets at the first failed insertion, as documented on
+	// NewFunnelHashTable; 1 means it reaches Capacity.
+	for _, tc := range []struct {
+		b     int
+		delta float64
+		fill  float64
+	}{
+		{1, 0.01, 0.80}, {1, 0.05, 0.84}, {1, 0.1, 0.78}, {1, 0.2, 0.87},
+		{2, 0.01, 0.93}, {2, 0.05, 0.97}, {2, 0.1, 0.95}, {2, 0.2, 1},
+		{3, 0.01, 0.96}, {3, 0.05, 1},
+		{4, 0.01, 0.98}, {4, 0.05, 1},
+		{8, 0.01, 1},
+	} {
+		ht := NewFunnelHashTable(10000, tc.b, tc.delta)
+		for k := 0; ht.Size() < ht.Capacity(); k++ {
+			if ht.Insert(k) != nil {
+				break
+			}
+		}
+		if fill := float64(ht.Size()) / float64(ht.Capacity()); fill < tc.fill {
+			t.Errorf("b=%d delta=%v: first failure at %.3f of capacity, expected at least %.2f",
+				tc.b, tc.delta, fill, tc.fill)
+		}
+	}
+}
+
+// BenchmarkOddSizeLookup compares lookups in tables of a power-of-two size
+// and of a prime size, which should cost the same.
+func BenchmarkOddSizeLookup(b *testing.B) {
+	for _, N := range []int{65536, 65537} {
+		for _, kind := range []string{"Elastic", "Funnel"} {
+			var ht Table
+			if kind == "Elastic" {
+				ht = NewElasticHashTable(N, 0.1)
+			} else {
+				ht = NewFunnelHashTable(N, 4, 0.1)
+			}
+			n := 0
+			for ; ht.Size() < ht.Capacity(); n++ {
+				ht.Insert(n)
+			}
+			b.Run(fmt.Sprintf("%s/N=%d", kind, N), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					ht.Contains(i % n)
+				}
+			})
+		}
+	}
+}
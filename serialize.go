@@ -0,0 +1,288 @@
+package elastichash
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strconv"
+	"unsafe"
+)
+
+// Binary snapshot format
+//
+// A serialized table is a sequence of little-endian 64-bit words. The header
+// is followed by the slot arrays stored verbatim, one word per slot, so that
+// a file mapped at a page boundary can be used in place without decoding:
+//
+//	Elastic: magic, version, flags, L, R, size, capacity, delta,
+//	         then for each of the L levels: length, slots...
+//	Funnel:  magic, version, flags, b, size, capacity, delta, levels,
+//	         then for each level: numBuckets, slots...,
+//	         then the special array: length, slots...
+//
+// Flags bit 0 marks an elastic table with permuted probe sequences, bit 1 a
+// funnel table with the aligned bucket stride, whose level slots include the
+// padding; other bits are reserved and must be zero.
+const (
+	elasticMagic  = 0x3143495453414c45 // "ELASTIC1" read as a little-endian word
+	funnelMagic   = 0x31304c454e4e5546 // "FUNNEL01" read as a little-endian word
+	formatVersion = 2                  // 2: multiply-shift slot positions
+	wordSize      = 8
+
+	// Flags word bits
+	flagPermuted = 1 << 0 // elastic: permuted probe sequences
+	flagAligned  = 1 << 1 // funnel: cache line aligned bucket stride
+)
+
+var errCorrupt = errors.New("corrupt or truncated table snapshot")
+
+// MarshalBinary encodes the table into the binary snapshot format.
+func (ht *ElasticHashTable) MarshalBinary() ([]byte, error) {
+	n := 8
+	for _, lvl := range ht.levels {
+		n += 1 + len(lvl)
+	}
+	w := &wordWriter{buf: make([]byte, 0, n*wordSize)}
+	w.put(elasticMagic)
+	w.put(formatVersion)
+	var flags uint64
+	if ht.permuted {
+		flags |= flagPermuted
+	}
+	w.put(flags)
+	w.put(uint64(ht.L))
+	w.put(uint64(ht.R))
+	w.put(uint64(ht.Size()))
+	w.put(uint64(ht.capacity))
+	w.put(math.Float64bits(ht.delta))
+	for _, lvl := range ht.levels {
+		w.putSlots(lvl)
+	}
+	return w.buf, nil
+}
+
+// UnmarshalBinary replaces the contents of the table with a snapshot produced
+// by MarshalBinary.
+func (ht *ElasticHashTable) UnmarshalBinary(data []byte) error {
+	t, err := decodeElastic(data, false)
+	if err != nil {
+		return err
+	}
+	*ht = *t
+	return nil
+}
+
+// MarshalBinary encodes the table into the binary snapshot format.
+func (ht *FunnelHashTable) MarshalBinary() ([]byte, error) {
+	n := 8 + 1 + len(ht.special)
+	for _, lvl := range ht.levels {
+		n += 1 + len(lvl.slots)
+	}
+	w := &wordWriter{buf: make([]byte, 0, n*wordSize)}
+	w.put(funnelMagic)
+	w.put(formatVersion)
+	var flags uint64
+	if ht.aligned {
+		flags |= flagAligned
+	}
+	w.put(flags)
+	w.put(uint64(ht.b))
+	w.put(uint64(ht.Size()))
+	w.put(uint64(ht.capacity))
+	w.put(math.Float64bits(ht.delta))
+	w.put(uint64(len(ht.levels)))
+	for _, lvl := range ht.levels {
+		w.put(uint64(lvl.numBuckets))
+		w.putRaw(lvl.slots)
+	}
+	w.putSlots(ht.special)
+	return w.buf, nil
+}
+
+// UnmarshalBinary replaces the contents of the table with a snapshot produced
+// by MarshalBinary.
+func (ht *FunnelHashTable) UnmarshalBinary(data []byte) error {
+	t, err := decodeFunnel(data, false)
+	if err != nil {
+		return err
+	}
+	*ht = *t
+	return nil
+}
+
+// decodeElastic parses an elastic snapshot. When alias is set the level slices
+// point into data instead of being copied; the caller must keep data alive and
+// 8-byte aligned for as long as the table is used.
+func decodeElastic(data []byte, alias bool) (*ElasticHashTable, error) {
+	r := &wordReader{data: data, alias: alias}
+	if r.get() != elasticMagic {
+		return nil, errors.New("not an elastic hash table snapshot")
+	}
+	if v := r.get(); v != formatVersion {
+		return nil, errors.New("unsupported snapshot version " + strconv.FormatUint(v, 10))
+	}
+	flags := r.get()
+	L := int(r.get())
+	R := int(r.get())
+	size := r.get()
+	capacity := int(r.get())
+	delta := math.Float64frombits(r.get())
+	if r.err != nil || flags&^flagPermuted != 0 || L < 2 || L > 64 || R < 1 || size > uint64(capacity) {
+		return nil, errCorrupt
+	}
+	ht := &ElasticHashTable{
+		levels:   make([][]int, L),
+		L:        L,
+		R:        R,
+		permuted: flags&flagPermuted != 0,
+		size:     int32(size),
+		capacity: capacity,
+		delta:    delta,
+	}
+	for i := range ht.levels {
+		ht.levels[i] = r.getSlots()
+		if len(ht.levels[i]) == 0 {
+			return nil, errCorrupt
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return ht, nil
+}
+
+// decodeFunnel parses a funnel snapshot, see decodeElastic for alias.
+func decodeFunnel(data []byte, alias bool) (*FunnelHashTable, error) {
+	r := &wordReader{data: data, alias: alias}
+	if r.get() != funnelMagic {
+		return nil, errors.New("not a funnel hash table snapshot")
+	}
+	if v := r.get(); v != formatVersion {
+		return nil, errors.New("unsupported snapshot version " + strconv.FormatUint(v, 10))
+	}
+	flags := r.get()
+	b := int(r.get())
+	size := r.get()
+	capacity := int(r.get())
+	delta := math.Float64frombits(r.get())
+	B := int(r.get())
+	if r.err != nil || flags&^flagAligned != 0 || b < 1 || B < 1 || B > 64 || size > uint64(capacity) {
+		return nil, errCorrupt
+	}
+	aligned := flags&flagAligned != 0
+	stride := bucketStride(b, aligned)
+	ht := &FunnelHashTable{
+		levels:   make([]Level, B),
+		b:        b,
+		stride:   stride,
+		aligned:  aligned,
+		size:     int32(size),
+		capacity: capacity,
+		delta:    delta,
+	}
+	for i := range ht.levels {
+		numB := int(r.get())
+		if numB < 1 || numB > len(data)/wordSize/stride {
+			return nil, errCorrupt
+		}
+		slots := r.getRaw(numB * stride)
+		if aligned && !alias {
+			// Mapped slots keep the stride but only the file's alignment
+			slots = cloneSlots(slots, true)
+		}
+		ht.levels[i] = Level{
+			slots:      slots,
+			numBuckets: numB,
+		}
+	}
+	ht.special = r.getSlots()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(ht.special) == 0 {
+		return nil, errCorrupt
+	}
+	return ht, nil
+}
+
+// canAlias reports whether slot words in the snapshot format can be used in
+// place as []int on this platform.
+func canAlias() bool {
+	one := uint16(1)
+	return strconv.IntSize == 64 && *(*byte)(unsafe.Pointer(&one)) == 1
+}
+
+type wordWriter struct {
+	buf []byte
+}
+
+func (w *wordWriter) put(v uint64) {
+	w.buf = binary.LittleEndian.AppendUint64(w.buf, v)
+}
+
+// putSlots writes a length-prefixed slot array.
+func (w *wordWriter) putSlots(s []int) {
+	w.put(uint64(len(s)))
+	w.putRaw(s)
+}
+
+func (w *wordWriter) putRaw(s []int) {
+	for _, v := range s {
+		w.put(uint64(int64(v)))
+	}
+}
+
+type wordReader struct {
+	data  []byte
+	off   int
+	alias bool
+	err   error
+}
+
+func (r *wordReader) get() uint64 {
+	if r.err != nil || len(r.data)-r.off < wordSize {
+		r.err = errCorrupt
+		return 0
+	}
+	v := binary.LittleEndian.Uint64(r.data[r.off:])
+	r.off += wordSize
+	return v
+}
+
+// getSlots reads a length-prefixed slot array.
+func (r *wordReader) getSlots() []int {
+	n := r.get()
+	if r.err != nil || n > uint64(len(r.data)/wordSize) {
+		r.err = errCorrupt
+		return nil
+	}
+	return r.getRaw(int(n))
+}
+
+func (r *wordReader) getRaw(n int) []int {
+	if r.err != nil || n < 0 || (len(r.data)-r.off)/wordSize < n {
+		r.err = errCorrupt
+		return nil
+	}
+	raw := r.data[r.off : r.off+n*wordSize]
+	r.off += n * wordSize
+	if n == 0 {
+		return []int{}
+	}
+	if r.alias {
+		return unsafe.Slice((*int)(unsafe.Pointer(&raw[0])), n)
+	}
+	s := make([]int, n)
+	for i := range s {
+		s[i] = int(int64(binary.LittleEndian.Uint64(raw[i*wordSize:])))
+	}
+	return s
+}
+
+// decodeTable parses a snapshot of either table kind, chosen by its magic word.
+func decodeTable(data []byte) (Table, error) {
+	if len(data) >= wordSize && binary.LittleEndian.Uint64(data) == funnelMagic {
+		return decodeFunnel(data, false)
+	}
+	return decodeElastic(data, false)
+}
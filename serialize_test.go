@@ -0,0 +1,54 @@
+package elastichash
+
+import "testing"
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	eht := NewElasticHashTable(500, 0.2)
+	fht := NewFunnelHashTable(500, 4, 0.2)
+	for i := 0; i < 300; i++ {
+		eht.Insert(i * 7)
+		fht.Insert(i * 7)
+	}
+	eht.Remove(7)
+	fht.Remove(7)
+
+	edata, _ := eht.MarshalBinary()
+	fdata, _ := fht.MarshalBinary()
+
+	var e2 ElasticHashTable
+	if err := e2.UnmarshalBinary(edata); err != nil {
+		t.Fatal(err)
+	}
+	var f2 FunnelHashTable
+	if err := f2.UnmarshalBinary(fdata); err != nil {
+		t.Fatal(err)
+	}
+	if e2.Size() != eht.Size() || e2.Capacity() != eht.Capacity() {
+		t.Errorf("Elastic size/capacity %d/%d, expected %d/%d", e2.Size(), e2.Capacity(), eht.Size(), eht.Capacity())
+	}
+	if f2.Size() != fht.Size() || f2.Capacity() != fht.Capacity() {
+		t.Errorf("Funnel size/capacity %d/%d, expected %d/%d", f2.Size(), f2.Capacity(), fht.Size(), fht.Capacity())
+	}
+	for i := 0; i < 2100; i++ {
+		if e2.Contains(i) != eht.Contains(i) {
+			t.Errorf("Elastic Contains(%d) differs after round trip", i)
+		}
+		if f2.Contains(i) != fht.Contains(i) {
+			t.Errorf("Funnel Contains(%d) differs after round trip", i)
+		}
+	}
+
+	// Decoded tables stay writable
+	if err := e2.Insert(7); err != nil || !e2.Contains(7) {
+		t.Errorf("Insert after round trip failed: %v", err)
+	}
+
+	for _, n := range []int{0, 8, len(edata) - 8} {
+		if err := new(ElasticHashTable).UnmarshalBinary(edata[:n]); err == nil {
+			t.Errorf("Unmarshal of %d-byte prefix should fail", n)
+		}
+	}
+	if err := new(FunnelHashTable).UnmarshalBinary(edata); err == nil {
+		t.Errorf("Unmarshal of an elastic snapshot into a funnel table should fail")
+	}
+}
@@ -0,0 +1,102 @@
+package elastichash
+
+import "math"
+
+// Set algebra between tables of any kind. Each operation iterates the smaller
+// operand where the result allows it, probes the other with Contains, and
+// builds the result with the bulk constructors. The result is sized for the
+// keys it holds plus room for a delta fraction of the larger operand, so
+// that it takes insertions like any other table. It has the kind of the first operand: a FunnelHashTable with
+// the same bucket size, delta and alignment, or else an ElasticHashTable with
+// the delta, probe count and probe order of the first operand (defaultDelta
+// and the default options for other Table implementations). Results are
+// never off-heap.
+
+// defaultDelta is the empty fraction used for results of operations whose
+// first operand does not record one.
+const defaultDelta = 0.1
+
+// Union returns a new table holding the keys present in a or b.
+func Union(a, b Table) (Table, error) {
+	small, large := a, b
+	if small.Size() > large.Size() {
+		small, large = large, small
+	}
+	keys := make([]int, 0, a.Size()+b.Size())
+	large.Range(func(key int) bool {
+		keys = append(keys, key)
+		return true
+	})
+	small.Range(func(key int) bool {
+		if !large.Contains(key) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	return newTableLike(a, b, keys)
+}
+
+// Intersect returns a new table holding the keys present in both a and b.
+func Intersect(a, b Table) (Table, error) {
+	small, large := a, b
+	if small.Size() > large.Size() {
+		small, large = large, small
+	}
+	var keys []int
+	small.Range(func(key int) bool {
+		if large.Contains(key) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	return newTableLike(a, b, keys)
+}
+
+// Difference returns a new table holding the keys of a that are not in b.
+func Difference(a, b Table) (Table, error) {
+	var keys []int
+	a.Range(func(key int) bool {
+		if !b.Contains(key) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	return newTableLike(a, b, keys)
+}
+
+// IsSubset reports whether every key of a is also in b.
+func IsSubset(a, b Table) bool {
+	if a.Size() > b.Size() {
+		return false
+	}
+	subset := true
+	a.Range(func(key int) bool {
+		subset = b.Contains(key)
+		return subset
+	})
+	return subset
+}
+
+// newTableLike builds a table of the same kind, delta and options as a
+// holding keys, which must be distinct, with room for a delta fraction of
+// the larger of a and b (at least one key) on top. It stays on the heap even
+// when a is off-heap, so that the result never needs Close.
+func newTableLike(a, b Table, keys []int) (Table, error) {
+	larger := max(a.Size(), b.Size())
+	switch t := a.(type) {
+	case *FunnelHashTable:
+		n := withRoom(len(keys), larger, t.delta)
+		return newFunnelFrom(keys, n, t.b, t.delta, FunnelOptions{Aligned: t.aligned})
+	case *ElasticHashTable:
+		n := withRoom(len(keys), larger, t.delta)
+		return newElasticFrom(keys, n, t.delta, ElasticOptions{Probes: t.R, Permuted: t.permuted})
+	default:
+		n := withRoom(len(keys), larger, defaultDelta)
+		return newElasticFrom(keys, n, defaultDelta, ElasticOptions{})
+	}
+}
+
+// withRoom returns the number of keys to size a result of n keys for.
+func withRoom(n, larger int, delta float64) int {
+	return n + max(1, int(math.Ceil(delta*float64(larger))))
+}
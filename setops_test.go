@@ -0,0 +1,139 @@
+package elastichash
+
+import "testing"
+
+func TestSetAlgebra(t *testing.T) {
+	// a = multiples of 2 below 200, b = multiples of 3 below 300
+	a := NewElasticHashTable(400, 0.25)
+	b := NewFunnelHashTable(400, 4, 0.25)
+	for i := 0; i < 200; i += 2 {
+		a.Insert(i)
+	}
+	for i := 0; i < 300; i += 3 {
+		b.Insert(i)
+	}
+
+	check := func(name string, got Table, want func(k int) bool) {
+		t.Helper()
+		n := 0
+		for k := 0; k < 300; k++ {
+			if got.Contains(k) != want(k) {
+				t.Errorf("%s: Contains(%d) should be %v", name, k, want(k))
+			}
+			if want(k) {
+				n++
+			}
+		}
+		if got.Size() != n {
+			t.Errorf("%s: expected size %d, got %d", name, n, got.Size())
+		}
+		if got.Capacity() < got.Size() {
+			t.Errorf("%s: capacity %d below size %d", name, got.Capacity(), got.Size())
+		}
+	}
+	inA := func(k int) bool { return k < 200 && k%2 == 0 }
+	inB := func(k int) bool { return k%3 == 0 }
+
+	u, err := Union(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("Union", u, func(k int) bool { return inA(k) || inB(k) })
+	if _, ok := u.(*ElasticHashTable); !ok {
+		t.Errorf("Union should have the kind of its first operand, got %T", u)
+	}
+
+	i, err := Intersect(b, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("Intersect", i, func(k int) bool { return inA(k) && inB(k) })
+	if f, ok := i.(*FunnelHashTable); !ok || f.b != 4 {
+		t.Errorf("Intersect should give a funnel table with bucket size 4, got %T", i)
+	}
+
+	d, err := Difference(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("Difference", d, func(k int) bool { return inA(k) && !inB(k) })
+
+	if IsSubset(a, b) || IsSubset(b, a) {
+		t.Errorf("Neither operand is a subset of the other")
+	}
+	if !IsSubset(i, a) || !IsSubset(i, b) || !IsSubset(d, a) || !IsSubset(a, u) {
+		t.Errorf("Subset relations between results do not hold")
+	}
+
+	empty := NewFunnelHashTable(10, 2, 0.5)
+	e, err := Intersect(empty, a)
+	if err != nil || e.Size() != 0 || !IsSubset(empty, a) {
+		t.Errorf("Operations with an empty table failed: %v", err)
+	}
+}
+
+func TestSetAlgebraKeepsOptions(t *testing.T) {
+	a := NewElasticHashTableWithOptions(400, 0.25, ElasticOptions{Probes: 6, Permuted: true})
+	b := NewFunnelHashTableWithOptions(400, 6, 0.25, FunnelOptions{Aligned: true})
+	for k := 0; k < 100; k++ {
+		a.Insert(k)
+		b.Insert(k * 2)
+	}
+	u, err := Union(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := u.(*ElasticHashTable); e.R != 6 || !e.permuted {
+		t.Errorf("Union of an elastic table lost its options: R=%d permuted=%v", e.R, e.permuted)
+	}
+	d, err := Difference(b, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := d.(*FunnelHashTable); !f.aligned || f.Size() != 50 {
+		t.Errorf("Difference of a funnel table lost its options: aligned=%v size=%d", f.aligned, f.Size())
+	}
+}
+
+func TestSetAlgebraSmallBuckets(t *testing.T) {
+	a := NewFunnelForCapacity(600, 2, 0.1)
+	b := NewFunnelForCapacity(600, 2, 0.1)
+	for k := 0; k < 600; k++ {
+		if err := a.Insert(k); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Insert(k + 300); err != nil {
+			t.Fatal(err)
+		}
+	}
+	u, err := Union(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Size() != 900 {
+		t.Errorf("Expected a union of 900 keys, got %d", u.Size())
+	}
+}
+
+func TestSetAlgebraResultsTakeInsertions(t *testing.T) {
+	forEachTable(t, Table(NewElasticHashTable(400, 0.1)), Table(NewFunnelHashTable(400, 2, 0.1)),
+		func(t *testing.T, a Table) {
+			b := NewElasticHashTable(400, 0.1)
+			for k := 0; k < 300; k++ {
+				a.Insert(k)
+				b.Insert(k + 100)
+			}
+			u, _ := Union(a, b)
+			i, _ := Intersect(a, b)
+			d, _ := Difference(a, b)
+			empty, _ := Intersect(a, NewElasticHashTable(10, 0.1))
+			for _, r := range []Table{u, i, d, empty} {
+				if r.Capacity() <= r.Size() {
+					t.Errorf("Result of %d keys has no room left (capacity %d)", r.Size(), r.Capacity())
+				}
+				if err := r.Insert(1 << 40); err != nil {
+					t.Errorf("Insert into a result of %d keys: %v", r.Size(), err)
+				}
+			}
+		})
+}
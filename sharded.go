@@ -0,0 +1,182 @@
+package elastichash
+
+import "sync"
+
+// ShardedTable splits keys over 2^k independent tables by the high bits of a
+// hash of the key. Each shard has its own RWMutex, so operations on different
+// shards proceed in parallel and throughput scales with the number of cores.
+// Contains takes a read lock, Insert and Remove a write lock on one shard.
+//
+// Each shard holds an equal part of the total capacity. Keys spread evenly,
+// but a shard can fill up slightly before the table as a whole does.
+type ShardedTable struct {
+	shards []tableShard
+	shift  uint // 64 - k
+}
+
+type tableShard struct {
+	mu sync.RWMutex
+	t  slotTable
+	_  [24]byte // pad to a cache line so neighbouring locks do not contend
+}
+
+// NewShardedElasticTable creates a ShardedTable of 2^k shards, each an
+// ElasticHashTable with an equal share of N total slots. It panics where
+// TryNewShardedElasticTable returns an error.
+func NewShardedElasticTable(k int, N int, delta float64) *ShardedTable {
+	return mustSharded(TryNewShardedElasticTable(k, N, delta))
+}
+
+// NewShardedFunnelTable creates a ShardedTable of 2^k shards, each a
+// FunnelHashTable with bucket size b and an equal share of N total slots.
+// It panics where TryNewShardedFunnelTable returns an error.
+func NewShardedFunnelTable(k int, N int, b int, delta float64) *ShardedTable {
+	return mustSharded(TryNewShardedFunnelTable(k, N, b, delta))
+}
+
+// TryNewShardedElasticTable is NewShardedElasticTable returning an error
+// instead of panicking, see TryNewElasticHashTable.
+func TryNewShardedElasticTable(k int, N int, delta float64) (*ShardedTable, error) {
+	return newShardedTable(KindElastic, k, func(n int) (slotTable, error) {
+		return TryNewElasticHashTable(n, delta, ElasticOptions{})
+	}, N)
+}
+
+// TryNewShardedFunnelTable is NewShardedFunnelTable returning an error
+// instead of panicking, see TryNewElasticHashTable.
+func TryNewShardedFunnelTable(k int, N int, b int, delta float64) (*ShardedTable, error) {
+	return newShardedTable(KindFunnel, k, func(n int) (slotTable, error) {
+		return TryNewFunnelHashTable(n, b, delta, FunnelOptions{})
+	}, N)
+}
+
+func newShardedTable(kind Kind, k int, create func(n int) (slotTable, error), N int) (*ShardedTable, error) {
+	if k < 0 || k > 16 {
+		return nil, invalidParams(kind, "shard bits must be in [0,16]")
+	}
+	n := 1 << k
+	st := &ShardedTable{shards: make([]tableShard, n), shift: uint(64 - k)}
+	per := (N + n - 1) / n
+	for i := range st.shards {
+		t, err := create(per)
+		if err != nil {
+			return nil, err
+		}
+		st.shards[i].t = t
+	}
+	return st, nil
+}
+
+func mustSharded(st *ShardedTable, err error) *ShardedTable {
+	if err != nil {
+		panic(err)
+	}
+	return st
+}
+
+// shard returns the shard owning key. The hash is independent of the ones
+// used inside the shards, so each shard still sees uniformly spread keys.
+func (st *ShardedTable) shard(key int) *tableShard {
+	if st.shift == 64 {
+		return &st.shards[0]
+	}
+	x := uint64(key) * 0xD6E8FEB86659FD93
+	x ^= x >> 32
+	x *= 0xD6E8FEB86659FD93
+	return &st.shards[x>>st.shift]
+}
+
+// Insert adds key to its shard.
+func (st *ShardedTable) Insert(key int) error {
+	s := st.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.t.Insert(key)
+}
+
+// Add inserts key and reports whether it was newly added, under a single
+// lock acquisition.
+func (st *ShardedTable) Add(key int) (added bool, err error) {
+	s := st.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return addKey(s.t, key)
+}
+
+// Contains reports whether key is present.
+func (st *ShardedTable) Contains(key int) bool {
+	s := st.shard(key)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.t.Contains(key)
+}
+
+// Remove deletes key and reports whether it was present.
+func (st *ShardedTable) Remove(key int) bool {
+	s := st.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.t.Remove(key)
+}
+
+// Size returns the number of keys over all shards. Shards are read one after
+// the other, so under concurrent writes the result is approximate.
+func (st *ShardedTable) Size() int {
+	n := 0
+	for i := range st.shards {
+		n += st.shards[i].t.Size() // size is atomic in both tables
+	}
+	return n
+}
+
+// Capacity returns the total capacity of all shards.
+func (st *ShardedTable) Capacity() int {
+	n := 0
+	for i := range st.shards {
+		n += st.shards[i].t.Capacity()
+	}
+	return n
+}
+
+// NumShards returns the number of shards.
+func (st *ShardedTable) NumShards() int {
+	return len(st.shards)
+}
+
+// Range calls fn for every key, one shard at a time, until fn returns false.
+// Each shard is read-locked while it is visited, so fn must not modify the
+// table.
+func (st *ShardedTable) Range(fn func(key int) bool) {
+	for i := range st.shards {
+		s := &st.shards[i]
+		s.mu.RLock()
+		more := true
+		s.t.Range(func(key int) bool {
+			more = fn(key)
+			return more
+		})
+		s.mu.RUnlock()
+		if !more {
+			return
+		}
+	}
+}
+
+// RangeParallel visits all shards concurrently, one goroutine per shard,
+// calling fn with the shard index and each of its keys. Returning false stops
+// the iteration of that shard only. fn must be safe for concurrent use and
+// must not modify the table. RangeParallel returns once every shard is done.
+func (st *ShardedTable) RangeParallel(fn func(shard int, key int) bool) {
+	var wg sync.WaitGroup
+	wg.Add(len(st.shards))
+	for i := range st.shards {
+		go func(i int) {
+			defer wg.Done()
+			s := &st.shards[i]
+			s.mu.RLock()
+			defer s.mu.RUnlock()
+			s.t.Range(func(key int) bool { return fn(i, key) })
+		}(i)
+	}
+	wg.Wait()
+}
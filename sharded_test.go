@@ -0,0 +1,113 @@
+package elastichash
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestShardedTable(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		st   *ShardedTable
+	}{
+		{"Elastic", NewShardedElasticTable(3, 80000, 0.1)},
+		{"Funnel", NewShardedFunnelTable(3, 80000, 8, 0.1)},
+		{"Single", NewShardedElasticTable(0, 10000, 0.1)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			st := tc.st
+			workers := 8
+			perWorker := st.Capacity() / 2 / workers
+
+			// Concurrent writers and readers over disjoint key ranges
+			var wg sync.WaitGroup
+			for w := 0; w < workers; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					base := w * perWorker
+					for i := base; i < base+perWorker; i++ {
+						if err := st.Insert(i); err != nil {
+							t.Errorf("Insert(%d): %v", i, err)
+							return
+						}
+						if !st.Contains(i) {
+							t.Errorf("Key %d missing right after Insert", i)
+							return
+						}
+					}
+					for i := base; i < base+perWorker; i += 2 {
+						st.Remove(i)
+					}
+				}(w)
+			}
+			wg.Wait()
+
+			want := workers * perWorker / 2
+			if st.Size() != want {
+				t.Errorf("Expected size %d, got %d", want, st.Size())
+			}
+			for i := 0; i < workers*perWorker; i++ {
+				if st.Contains(i) != (i%2 == 1) {
+					t.Fatalf("Contains(%d) = %v", i, st.Contains(i))
+				}
+			}
+
+			seen := 0
+			st.Range(func(key int) bool {
+				seen++
+				return true
+			})
+			var par int64
+			perShard := make([]int64, st.NumShards())
+			st.RangeParallel(func(shard, key int) bool {
+				atomic.AddInt64(&par, 1)
+				atomic.AddInt64(&perShard[shard], 1)
+				return true
+			})
+			if seen != want || int(par) != want {
+				t.Errorf("Range saw %d keys, RangeParallel %d, expected %d", seen, par, want)
+			}
+			// Keys should be spread roughly evenly over shards
+			for i, n := range perShard {
+				if n < int64(want/st.NumShards()*3/4) {
+					t.Errorf("Shard %d holds only %d of %d keys", i, n, want)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkShardedContains(b *testing.B) {
+	for _, tc := range []struct {
+		name string
+		t    Table
+	}{
+		{"Sharded", NewShardedElasticTable(6, 1<<20, 0.1)},
+		{"SingleLock", NewShardedElasticTable(0, 1<<20, 0.1)},
+	} {
+		for i := 0; i < tc.t.Capacity()/2; i++ {
+			tc.t.Insert(i)
+		}
+		b.Run(tc.name, func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				// Mostly lookups, with one in 16 operations rewriting a key
+				n := tc.t.Capacity() / 2
+				i := rand.Intn(n)
+				for pb.Next() {
+					key := i % n
+					if i%16 == 0 {
+						if tc.t.Remove(key) {
+							tc.t.Insert(key)
+						}
+					} else {
+						tc.t.Contains(key)
+					}
+					i += 7919
+				}
+			})
+		})
+	}
+}
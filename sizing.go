@@ -0,0 +1,308 @@
+package elastichash
+
+import (
+	"math"
+	"unsafe"
+)
+
+// wordBytes is the size of a slot.
+const wordBytes = int64(unsafe.Sizeof(int(0)))
+
+// MemoryStats breaks down the memory held by a table, in bytes.
+type MemoryStats struct {
+	// Slots is the size of the slot arrays: one word per slot that can hold
+	// a key.
+	Slots int64
+	// Metadata covers the table header, level descriptors, snapshot
+	// bookkeeping, the prefilter and the ordered index.
+	Metadata int64
+	// Overhead is memory allocated with the slots that never holds a key:
+	// the bucket padding of the aligned funnel layout and alignment slack.
+	Overhead int64
+	// OffHeap reports that the slots live outside the Go heap, in an
+	// off-heap allocation or a mapped file.
+	OffHeap bool
+}
+
+// Total returns the number of bytes over all parts.
+func (s MemoryStats) Total() int64 {
+	return s.Slots + s.Metadata + s.Overhead
+}
+
+// MemoryUsage reports the memory held by the table. A snapshot reports the
+// slots it references, which it shares with its table until either writes.
+func (ht *ElasticHashTable) MemoryUsage() MemoryStats {
+	sizes := make([]int, len(ht.levels))
+	for i, lvl := range ht.levels {
+		sizes[i] = len(lvl)
+	}
+	s := elasticMemory(sizes, ht.offHeap)
+	s.Metadata += int64(len(ht.shared)) + ht.filter.memory() + ht.index.memory()
+	s.OffHeap = ht.release != nil
+	return s
+}
+
+// MemoryUsage reports the memory held by the table, see
+// ElasticHashTable.MemoryUsage.
+func (ht *FunnelHashTable) MemoryUsage() MemoryStats {
+	buckets := make([]int, len(ht.levels))
+	for i, lvl := range ht.levels {
+		buckets[i] = lvl.numBuckets
+	}
+	s := funnelMemory(buckets, ht.b, len(ht.special), ht.aligned, ht.offHeap)
+	s.Metadata += int64(len(ht.shared)) + ht.filter.memory() + ht.index.memory()
+	s.OffHeap = ht.release != nil
+	return s
+}
+
+// memory returns the size of the filter, 0 for nil.
+func (f *bloomFilter) memory() int64 {
+	if f == nil {
+		return 0
+	}
+	return int64(unsafe.Sizeof(*f)) + int64(len(f.blocks))*8
+}
+
+// lineSlack returns the bytes needed to round n slots up to whole cache
+// lines, as offHeapSlots does for each array.
+func lineSlack(n int) int64 {
+	return int64((n+slotsPerLine-1)/slotsPerLine*slotsPerLine-n) * wordBytes
+}
+
+func elasticMemory(sizes []int, offHeap bool) MemoryStats {
+	s := MemoryStats{
+		Metadata: int64(unsafe.Sizeof(ElasticHashTable{})) + int64(len(sizes))*int64(unsafe.Sizeof([]int(nil))),
+	}
+	for _, n := range sizes {
+		s.Slots += int64(n) * wordBytes
+		if offHeap {
+			s.Overhead += lineSlack(n)
+		}
+	}
+	return s
+}
+
+func funnelMemory(buckets []int, b, special int, aligned, offHeap bool) MemoryStats {
+	stride := bucketStride(b, aligned)
+	s := MemoryStats{
+		Slots:    int64(special) * wordBytes,
+		Metadata: int64(unsafe.Sizeof(FunnelHashTable{})) + int64(len(buckets))*int64(unsafe.Sizeof(Level{})),
+	}
+	for _, numB := range buckets {
+		s.Slots += int64(numB*b) * wordBytes
+		s.Overhead += int64(numB*(stride-b)) * wordBytes
+		switch {
+		case offHeap:
+			s.Overhead += lineSlack(numB * stride)
+		case aligned:
+			s.Overhead += int64(slotsPerLine-1) * wordBytes // see alignedSlots
+		}
+	}
+	if offHeap {
+		s.Overhead += lineSlack(special)
+	}
+	return s
+}
+
+// EstimateOptions describes the table EstimateSize plans for.
+type EstimateOptions struct {
+	// Kind selects the table: KindElastic, the default, or KindFunnel.
+	Kind Kind
+	// BucketSize is b for a funnel table, 8 if zero.
+	BucketSize int
+	// Elastic and Funnel are the options the table will be created with.
+	Elastic ElasticOptions
+	Funnel  FunnelOptions
+}
+
+// SizeEstimate describes a table holding n keys before it is allocated.
+type SizeEstimate struct {
+	// N is the total size to pass to the constructor, as chosen by
+	// NewElasticForCapacity or NewFunnelForCapacity: the smallest whose
+	// capacity is at least n, grown for a funnel table until n keys are
+	// expected to fit.
+	N        int
+	Capacity int
+	// Memory is what MemoryUsage reports for the new table.
+	Memory MemoryStats
+	// HitProbes and MissProbes are the expected numbers of slots Contains
+	// examines once the table holds n keys, averaged over present keys and
+	// for an absent key respectively. They come from an analytical model
+	// of the probe walk that ignores tombstones and the prefilter.
+	HitProbes  float64
+	MissProbes float64
+}
+
+// EstimateSize reports the size, memory and expected lookup cost of a table
+// sized for n keys with the given delta, without allocating it.
+func EstimateSize(n int, delta float64, opts EstimateOptions) (SizeEstimate, error) {
+	kind := opts.Kind
+	if kind == 0 {
+		kind = KindElastic
+	}
+	if n < 0 {
+		return SizeEstimate{}, invalidParams(kind, "element count must not be negative")
+	}
+	if delta < 0 || delta >= 1 {
+		return SizeEstimate{}, invalidParams(kind, "delta must be in (0,1)")
+	}
+
+	var est SizeEstimate
+	switch kind {
+	case KindElastic:
+		est.N = slotsFor(n, delta)
+		R := opts.Elastic.Probes
+		if R < 0 {
+			return SizeEstimate{}, invalidParams(kind, "probe count must not be negative")
+		}
+		if R == 0 {
+			R = elasticLevels
+		}
+		sizes := elasticLayout(est.N, elasticLevels, R)
+		est.Memory = elasticMemory(sizes, opts.Elastic.OffHeap)
+		est.Memory.OffHeap = opts.Elastic.OffHeap
+		est.HitProbes, est.MissProbes = elasticProbes(sizes, R, opts.Elastic.Permuted, n)
+	case KindFunnel:
+		b := opts.BucketSize
+		if b == 0 {
+			b = 8
+		}
+		if b < 1 {
+			return SizeEstimate{}, invalidParams(kind, "bucket size must be positive")
+		}
+		est.N = funnelSlotsFor(n, b, delta)
+		buckets, special := funnelLayout(est.N, b, delta)
+		est.Memory = funnelMemory(buckets, b, special, opts.Funnel.Aligned, opts.Funnel.OffHeap)
+		est.Memory.OffHeap = opts.Funnel.OffHeap
+		est.HitProbes, est.MissProbes, _ = funnelProbes(buckets, b, special, n)
+	default:
+		return SizeEstimate{}, invalidParams(kind, "unknown table kind")
+	}
+	est.Capacity = int((1 - delta) * float64(est.N))
+	return est, nil
+}
+
+// linearProbes returns the expected slots examined by a successful and an
+// unsuccessful search in a linear probing array of m slots at load alpha
+// (Knuth's approximations), capped at m.
+func linearProbes(alpha float64, m int) (hit, miss float64) {
+	if alpha >= 1 {
+		return float64(m), float64(m)
+	}
+	hit = (1 + 1/(1-alpha)) / 2
+	miss = (1 + 1/((1-alpha)*(1-alpha))) / 2
+	return math.Min(hit, float64(m)), math.Min(miss, float64(m))
+}
+
+// elasticProbes models Contains on an elastic table with the given level
+// sizes holding n keys. The non-final levels are taken to fill up first;
+// the last level is a linear probing array.
+func elasticProbes(sizes []int, R int, permuted bool, n int) (hit, miss float64) {
+	var cost, upper float64 // total hit cost and probes through the full upper levels
+	left := n
+	for _, m := range sizes[:len(sizes)-1] {
+		// Distinct positions among R probes; repeats are skipped for free
+		d := float64(m) * (1 - math.Pow(1-1/float64(m), float64(R)))
+		if permuted {
+			d = float64(min(R, m))
+		}
+		k := min(left, m)
+		left -= k
+		cost += float64(k) * (upper + (d+1)/2)
+		// Contains walks the level until an EMPTY slot
+		phi := float64(k) / float64(m)
+		if phi < 1 {
+			miss += (1 - math.Pow(phi, d)) / (1 - phi)
+		} else {
+			miss += d
+		}
+		upper += d
+	}
+	m := sizes[len(sizes)-1]
+	lastHit, lastMiss := linearProbes(float64(left)/float64(m), m)
+	cost += float64(left) * (upper + lastHit)
+	miss += lastMiss
+	if n > 0 {
+		hit = cost / float64(n)
+	}
+	return hit, miss
+}
+
+// funnelProbes models Contains on a funnel table with the given layout
+// holding n keys. Insertions are followed as a fluid: for each level it
+// tracks the fraction of buckets holding j keys, and keys arriving at a full
+// bucket overflow to the next level, then to the special array. overflow is
+// the number of keys sent to the special array, which may exceed its size.
+func funnelProbes(buckets []int, b, special, n int) (hit, miss, overflow float64) {
+	const steps = 1000
+	fill := make([][]float64, len(buckets)) // fill[i][j]: share of level i buckets holding j keys
+	for i := range fill {
+		fill[i] = make([]float64, b+1)
+		fill[i][0] = 1
+	}
+	var cost, inSpecial float64
+	for t := 0; t < steps; t++ {
+		a := float64(n) / steps // keys arriving at the current level
+		for i, numB := range buckets {
+			q := fill[i]
+			// A key joining a bucket of j keys lands after j slots, past the
+			// full buckets of the earlier levels
+			for j := 0; j < b; j++ {
+				cost += a * q[j] * float64(i*b+j+1)
+			}
+			spill := a * q[b]
+			lam := a / float64(numB)
+			sub := int(lam/0.05) + 1 // keep each Euler step small
+			for s := 0; s < sub; s++ {
+				for j := b; j > 0; j-- {
+					if j == b {
+						q[j] += lam / float64(sub) * q[j-1]
+					} else {
+						q[j] += lam / float64(sub) * (q[j-1] - q[j])
+					}
+				}
+				q[0] -= lam / float64(sub) * q[0]
+			}
+			a = spill
+		}
+		if a > 0 {
+			// A key's later lookups cost what inserting it did: an
+			// unsuccessful search at the load it arrived at
+			_, insert := linearProbes(inSpecial/float64(special), special)
+			cost += a * (float64(len(buckets)*b) + insert)
+			inSpecial = math.Min(inSpecial+a, float64(special))
+			overflow += a
+		}
+	}
+
+	for _, q := range fill {
+		for j := 0; j < b; j++ {
+			miss += q[j] * float64(j+1)
+		}
+		miss += q[b] * float64(b)
+	}
+	_, specialMiss := linearProbes(inSpecial/float64(special), special)
+	miss += specialMiss
+	if n > 0 {
+		hit = cost / float64(n)
+	}
+	return hit, miss, overflow
+}
+
+// funnelSlotsFor returns the N for a funnel table sized for n keys: the
+// smallest of slotsFor(n, delta) and sizes about 1% apart above it at which
+// the keys expected to overflow the buckets fit in the special array with a
+// margin for chance. Small buckets fill unevenly, so for b=2, or delta near
+// zero, that takes more than n/(1-delta) slots.
+func funnelSlotsFor(n, b int, delta float64) int {
+	N := slotsFor(n, delta)
+	for n > 0 {
+		buckets, special := funnelLayout(N, b, delta)
+		_, _, overflow := funnelProbes(buckets, b, special, n)
+		if overflow+4*math.Sqrt(overflow)+float64(b) <= float64(special) {
+			break
+		}
+		N += max(1, N/100)
+	}
+	return N
+}
@@ -0,0 +1,174 @@
+package elastichash
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// elasticContainsProbes counts the slots ElasticHashTable.Contains examines.
+func elasticContainsProbes(ht *ElasticHashTable, key int) int {
+	probes := 0
+	for i := 0; i < ht.L-1; i++ {
+		level := ht.levels[i]
+		seq := ht.probes(key, i, len(level))
+		for attempt := 0; attempt < ht.R; attempt++ {
+			pos := seq.at(attempt)
+			if !seq.fresh(pos) {
+				continue
+			}
+			probes++
+			if level[pos] == key {
+				return probes
+			}
+			if level[pos] == EMPTY {
+				break
+			}
+		}
+	}
+	last := ht.levels[ht.L-1]
+	pos := ht.hashFunc(key, ht.L-1, 0, len(last))
+	for {
+		probes++
+		if last[pos] == key || last[pos] == EMPTY {
+			return probes
+		}
+		pos = (pos + 1) % len(last)
+	}
+}
+
+// funnelContainsProbes counts the slots FunnelHashTable.Contains examines.
+func funnelContainsProbes(ht *FunnelHashTable, key int) int {
+	probes := 0
+	for i := range ht.levels {
+		start := ht.hashFunc(key, i) * ht.stride
+		for j := start; j < start+ht.b; j++ {
+			probes++
+			if ht.levels[i].slots[j] == key {
+				return probes
+			}
+			if ht.levels[i].slots[j] == EMPTY {
+				break
+			}
+		}
+	}
+	pos := ht.specialStart(key)
+	for {
+		probes++
+		if ht.special[pos] == key || ht.special[pos] == EMPTY {
+			return probes
+		}
+		pos = (pos + 1) % len(ht.special)
+	}
+}
+
+func TestMemoryUsage(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts EstimateOptions
+		ht   testTable
+	}{
+		{"Elastic", EstimateOptions{}, NewElasticHashTable(slotsFor(10000, 0.1), 0.1)},
+		{"Funnel", EstimateOptions{Kind: KindFunnel, BucketSize: 4},
+			NewFunnelHashTable(slotsFor(10000, 0.1), 4, 0.1)},
+		{"FunnelAligned", EstimateOptions{Kind: KindFunnel, BucketSize: 6, Funnel: FunnelOptions{Aligned: true}},
+			NewFunnelHashTableWithOptions(slotsFor(10000, 0.1), 6, 0.1, FunnelOptions{Aligned: true})},
+		{"FunnelOffHeap", EstimateOptions{Kind: KindFunnel, BucketSize: 6, Funnel: FunnelOptions{OffHeap: true}},
+			NewFunnelHashTableWithOptions(slotsFor(10000, 0.1), 6, 0.1, FunnelOptions{OffHeap: true})},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			defer tc.ht.Close()
+			est, err := EstimateSize(10000, 0.1, tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := tc.ht.MemoryUsage()
+			if got != est.Memory {
+				t.Errorf("MemoryUsage %+v, estimated %+v", got, est.Memory)
+			}
+			if got.Slots < int64(est.N)*wordBytes || est.Capacity < 10000 || tc.ht.Capacity() != est.Capacity {
+				t.Errorf("Estimate %+v does not describe the table", est)
+			}
+			if tc.opts.Funnel.Aligned && got.Overhead < got.Slots/4 {
+				t.Errorf("b=6 aligned: expected the padding in Overhead, got %+v", got)
+			}
+		})
+	}
+
+	ht := NewElasticHashTable(1000, 0.1)
+	before := ht.MemoryUsage()
+	ht.EnablePrefilter(10)
+	if after := ht.MemoryUsage(); after.Metadata <= before.Metadata || after.Slots != before.Slots {
+		t.Errorf("Prefilter not counted as metadata: %+v then %+v", before, after)
+	}
+}
+
+func TestEstimateProbes(t *testing.T) {
+	const n = 50000
+	for _, tc := range []struct {
+		name  string
+		delta float64
+		opts  EstimateOptions
+	}{
+		{"Elastic/0.1", 0.1, EstimateOptions{}},
+		{"Elastic/0.3", 0.3, EstimateOptions{}},
+		{"ElasticPermuted/0.1", 0.1, EstimateOptions{Elastic: ElasticOptions{Permuted: true}}},
+		{"Funnel4/0.1", 0.1, EstimateOptions{Kind: KindFunnel, BucketSize: 4}},
+		{"Funnel8/0.1", 0.1, EstimateOptions{Kind: KindFunnel, BucketSize: 8}},
+		{"Funnel8/0.3", 0.3, EstimateOptions{Kind: KindFunnel, BucketSize: 8}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			est, err := EstimateSize(n, tc.delta, tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var probes func(key int) int
+			var ht Table
+			if tc.opts.Kind == KindFunnel {
+				fht := NewFunnelHashTable(est.N, tc.opts.BucketSize, tc.delta)
+				ht, probes = fht, func(key int) int { return funnelContainsProbes(fht, key) }
+			} else {
+				eht := NewElasticHashTableWithOptions(est.N, tc.delta, tc.opts.Elastic)
+				ht, probes = eht, func(key int) int { return elasticContainsProbes(eht, key) }
+			}
+			for k := 0; k < n; k++ {
+				if err := ht.Insert(k); err != nil {
+					t.Fatalf("Insert(%d): %v", k, err)
+				}
+			}
+			var hit, miss float64
+			for k := 0; k < n; k++ {
+				hit += float64(probes(k))
+				miss += float64(probes(n + k))
+			}
+			hit /= n
+			miss /= n
+
+			// The model should land within 15% of the measured averages
+			if math.Abs(est.HitProbes-hit) > 0.15*hit {
+				t.Errorf("Hit probes: estimated %.2f, measured %.2f", est.HitProbes, hit)
+			}
+			if math.Abs(est.MissProbes-miss) > 0.15*miss {
+				t.Errorf("Miss probes: estimated %.2f, measured %.2f", est.MissProbes, miss)
+			}
+		})
+	}
+}
+
+func TestEstimateSizeErrors(t *testing.T) {
+	for _, tc := range []struct {
+		n     int
+		delta float64
+		opts  EstimateOptions
+	}{
+		{-1, 0.1, EstimateOptions{}},
+		{100, 1, EstimateOptions{}},
+		{100, 0.1, EstimateOptions{Kind: KindFunnel, BucketSize: -1}},
+		{100, 0.1, EstimateOptions{Elastic: ElasticOptions{Probes: -1}}},
+		{100, 0.1, EstimateOptions{Kind: Kind(9)}},
+	} {
+		if _, err := EstimateSize(tc.n, tc.delta, tc.opts); !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("EstimateSize(%d, %v, %+v): expected ErrInvalidParams, got %v", tc.n, tc.delta, tc.opts, err)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package elastichash
+
+import "sync/atomic"
+
+// Snapshot returns a read-only view of the table as it is now. The view
+// shares slot memory with the table, so taking it is O(1); the table copies
+// a level the first time it writes to it afterwards, leaving the view
+// untouched. Readers of the view may run concurrently with writers of the
+// table, but Snapshot itself must not race with writers.
+//
+// The view stays valid after further snapshots are taken, but not after the
+// table is closed when it was opened from a mapped file.
+func (ht *ElasticHashTable) Snapshot() *ElasticHashTable {
+	snap := &ElasticHashTable{
+		levels:    append([][]int(nil), ht.levels...),
+		L:         ht.L,
+		R:         ht.R,
+		permuted:  ht.permuted,
+		size:      atomic.LoadInt32(&ht.size),
+		capacity:  ht.capacity,
+		delta:     ht.delta,
+		readOnly:  true,
+		filter:    ht.filter,
+		scanLimit: ht.scanLimit,
+	}
+	if ht.index != nil {
+		ix := *ht.index
+		snap.index = &ix
+	}
+	if !ht.readOnly {
+		ht.filterShared = ht.filter != nil
+		ht.shared = make([]bool, len(ht.levels))
+		for i := range ht.shared {
+			ht.shared[i] = true
+		}
+	}
+	return snap
+}
+
+// own makes level i private to the table before it is written, copying it
+// if it is still shared with a snapshot.
+func (ht *ElasticHashTable) own(i int) {
+	if ht.shared != nil && ht.shared[i] {
+		ht.levels[i] = append([]int(nil), ht.levels[i]...)
+		ht.shared[i] = false
+	}
+}
+
+// Snapshot returns a read-only view of the table as it is now, see
+// ElasticHashTable.Snapshot.
+func (ht *FunnelHashTable) Snapshot() *FunnelHashTable {
+	snap := &FunnelHashTable{
+		levels:    append([]Level(nil), ht.levels...),
+		special:   ht.special,
+		b:         ht.b,
+		stride:    ht.stride,
+		aligned:   ht.aligned,
+		size:      atomic.LoadInt32(&ht.size),
+		capacity:  ht.capacity,
+		delta:     ht.delta,
+		readOnly:  true,
+		filter:    ht.filter,
+		scanLimit: ht.scanLimit,
+	}
+	if ht.index != nil {
+		ix := *ht.index
+		snap.index = &ix
+	}
+	if !ht.readOnly {
+		ht.filterShared = ht.filter != nil
+		ht.shared = make([]bool, len(ht.levels)+1)
+		for i := range ht.shared {
+			ht.shared[i] = true
+		}
+	}
+	return snap
+}
+
+// own makes level i private to the table before it is written, copying it
+// if it is still shared with a snapshot. Level len(levels) is the special
+// array.
+func (ht *FunnelHashTable) own(i int) {
+	if ht.shared == nil || !ht.shared[i] {
+		return
+	}
+	if i == len(ht.levels) {
+		ht.special = append([]int(nil), ht.special...)
+	} else {
+		ht.levels[i].slots = cloneSlots(ht.levels[i].slots, ht.aligned)
+	}
+	ht.shared[i] = false
+}
@@ -0,0 +1,54 @@
+package elastichash
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSnapshotIsolation(t *testing.T) {
+	forEachTable[testTable](t, NewElasticHashTable(1000, 0.1), NewFunnelHashTable(1000, 8, 0.1), func(t *testing.T, live testTable) {
+		for i := 0; i < 500; i++ {
+			live.Insert(i)
+		}
+		snap := snapshotOf(live)
+
+		// Readers of the snapshot run while the table keeps changing
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for round := 0; round < 5; round++ {
+				for i := 0; i < 1000; i++ {
+					if snap.Contains(i) != (i < 500) {
+						t.Errorf("Snapshot Contains(%d) changed", i)
+						return
+					}
+				}
+			}
+		}()
+		for i := 0; i < 250; i++ {
+			live.Remove(i)
+			live.Insert(500 + i)
+		}
+		wg.Wait()
+
+		if snap.Size() != 500 {
+			t.Errorf("Snapshot size should stay 500, got %d", snap.Size())
+		}
+		for i := 0; i < 1000; i++ {
+			if live.Contains(i) != (i >= 250 && i < 750) {
+				t.Errorf("Live Contains(%d) wrong after writes", i)
+			}
+		}
+		if snap.Insert(2000) == nil || snap.Remove(300) {
+			t.Errorf("Snapshot should be read-only")
+		}
+
+		// A second snapshot sees the later state and the first is unaffected
+		snap2 := snapshotOf(live)
+		live.Insert(5000)
+		if !snap2.Contains(700) || snap2.Contains(5000) || snap.Contains(700) {
+			t.Errorf("Second snapshot has the wrong contents")
+		}
+	})
+}
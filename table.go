@@ -0,0 +1,24 @@
+package elastichash
+
+// Table is the integer set interface implemented by ElasticHashTable,
+// FunnelHashTable and the wrappers built on top of them.
+type Table interface {
+	// Insert adds key to the set. Inserting a key that is already present is
+	// not an error and leaves the set unchanged.
+	Insert(key int) error
+	// Contains reports whether key is in the set.
+	Contains(key int) bool
+	// Remove deletes key and reports whether it was present.
+	Remove(key int) bool
+	// Size returns the number of keys in the set.
+	Size() int
+	// Capacity returns the maximum number of keys the set can hold.
+	Capacity() int
+	// Range calls fn for every key in the set until fn returns false.
+	Range(fn func(key int) bool)
+}
+
+var (
+	_ Table = (*ElasticHashTable)(nil)
+	_ Table = (*FunnelHashTable)(nil)
+)
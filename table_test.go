@@ -0,0 +1,49 @@
+package elastichash
+
+import "testing"
+
+// testTable is the API that ElasticHashTable and FunnelHashTable share beyond
+// Table, for the tests that run the same checks on both kinds.
+type testTable interface {
+	Table
+	Add(key int) (bool, error)
+	LoadOrStore(key int) (bool, error)
+	Replace(old, new int) (bool, error)
+	InsertBatch(keys []int) error
+	RemoveBatch(keys []int) int
+	ContainsBatch(keys []int, out []bool)
+	EnablePrefilter(bitsPerKey int)
+	RebuildPrefilter()
+	DisablePrefilter()
+	EnableOrderedIndex()
+	DisableOrderedIndex()
+	RangeKeys(lo, hi int, fn func(key int) bool)
+	MemoryUsage() MemoryStats
+	MarshalBinary() ([]byte, error)
+	Close() error
+}
+
+var (
+	_ testTable = (*ElasticHashTable)(nil)
+	_ testTable = (*FunnelHashTable)(nil)
+)
+
+// forEachTable runs fn as an "Elastic" and a "Funnel" subtest, on the two
+// values given: usually a table of each kind as a testTable, but also tables
+// wrapped in another type or constructors for them.
+func forEachTable[T any](t *testing.T, elastic, funnel T, fn func(t *testing.T, ht T)) {
+	t.Helper()
+	t.Run("Elastic", func(t *testing.T) { fn(t, elastic) })
+	t.Run("Funnel", func(t *testing.T) { fn(t, funnel) })
+}
+
+// snapshotOf returns a snapshot of an elastic or funnel table.
+func snapshotOf(ht testTable) Table {
+	switch ht := ht.(type) {
+	case *ElasticHashTable:
+		return ht.Snapshot()
+	case *FunnelHashTable:
+		return ht.Snapshot()
+	}
+	panic("snapshotOf: unknown table type")
+}
@@ -0,0 +1,224 @@
+package elastichash
+
+import (
+	"sync"
+	"time"
+)
+
+// TTLOptions configures a TTLTable.
+type TTLOptions struct {
+	// DefaultTTL is the lifetime given to keys added with Insert. Zero means
+	// such keys never expire.
+	DefaultTTL time.Duration
+	// Clock returns the current time. It defaults to time.Now and can be
+	// replaced in tests.
+	Clock func() time.Time
+}
+
+// TTLTable is an integer set whose keys expire. Each slot of the underlying
+// ElasticHashTable or FunnelHashTable carries an expiration time; an expired
+// key is treated as absent and its slot is tombstoned the next time an
+// operation finds it. Sweep, or a sweeper started with StartSweeper,
+// reclaims expired slots that are never looked up again.
+//
+// Size counts expired keys until they are reclaimed. A TTLTable is safe for
+// concurrent use.
+type TTLTable struct {
+	mu         sync.Mutex
+	t          slotTable
+	expires    [][]int64 // unix nanoseconds, parallel to the table segments; 0 never expires
+	defaultTTL time.Duration
+	now        func() time.Time
+}
+
+// NewTTLElasticTable creates a TTLTable laid out like
+// NewElasticHashTable(N, delta). A nil opts uses the defaults.
+func NewTTLElasticTable(N int, delta float64, opts *TTLOptions) *TTLTable {
+	return newTTLTable(NewElasticHashTable(N, delta), opts)
+}
+
+// NewTTLFunnelTable creates a TTLTable laid out like
+// NewFunnelHashTable(N, b, delta). A nil opts uses the defaults.
+func NewTTLFunnelTable(N int, b int, delta float64, opts *TTLOptions) *TTLTable {
+	return newTTLTable(NewFunnelHashTable(N, b, delta), opts)
+}
+
+func newTTLTable(t slotTable, opts *TTLOptions) *TTLTable {
+	tt := &TTLTable{t: t, expires: make([][]int64, t.numSegments()), now: time.Now}
+	if opts != nil {
+		tt.defaultTTL = opts.DefaultTTL
+		if opts.Clock != nil {
+			tt.now = opts.Clock
+		}
+	}
+	for i := range tt.expires {
+		tt.expires[i] = make([]int64, len(t.segment(i)))
+	}
+	return tt
+}
+
+// lookup is find for keys that have not expired. An expired key is
+// tombstoned and then reported like an absent one, with the slot where it
+// would be inserted. Caller holds tt.mu.
+func (tt *TTLTable) lookup(key int, now int64) (slotRef, bool) {
+	ref, found := tt.t.find(key)
+	if found && tt.expired(ref, now) {
+		tt.clear(ref)
+		return tt.t.find(key)
+	}
+	return ref, found
+}
+
+func (tt *TTLTable) expired(ref slotRef, now int64) bool {
+	exp := tt.expires[ref.lvl][ref.pos]
+	return exp != 0 && now >= exp
+}
+
+// clear tombstones a slot. Caller holds tt.mu.
+func (tt *TTLTable) clear(ref slotRef) {
+	tt.t.own(ref.lvl)
+	tt.t.segment(ref.lvl)[ref.pos] = TOMBSTONE
+	tt.expires[ref.lvl][ref.pos] = 0
+	tt.t.addSize(-1)
+}
+
+// Insert adds key with the default TTL, see InsertTTL.
+func (tt *TTLTable) Insert(key int) error {
+	return tt.InsertTTL(key, tt.defaultTTL)
+}
+
+// InsertTTL adds key so that it expires after ttl; zero means never. If key
+// is already present its expiration is replaced. When the table is full,
+// expired slots are swept before giving up.
+func (tt *TTLTable) InsertTTL(key int, ttl time.Duration) error {
+	if key == EMPTY || key == TOMBSTONE {
+		return tt.t.fail(ErrInvalidKey, -1)
+	}
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	now := tt.now().UnixNano()
+	var exp int64
+	if ttl > 0 {
+		exp = now + int64(ttl)
+	}
+
+	ref, found := tt.lookup(key, now)
+	if found {
+		tt.expires[ref.lvl][ref.pos] = exp
+		return nil
+	}
+	if tt.t.Size() >= tt.t.Capacity() {
+		for i := range tt.expires {
+			tt.sweepSegment(i, now)
+		}
+		if tt.t.Size() >= tt.t.Capacity() {
+			return tt.t.fail(ErrFull, -1)
+		}
+		ref, _ = tt.t.find(key)
+	}
+	if ref.lvl < 0 {
+		return tt.t.noSlot()
+	}
+	tt.t.own(ref.lvl)
+	tt.t.segment(ref.lvl)[ref.pos] = key
+	tt.expires[ref.lvl][ref.pos] = exp
+	tt.t.addSize(1)
+	return nil
+}
+
+// Contains reports whether key is present and has not expired.
+func (tt *TTLTable) Contains(key int) bool {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	_, found := tt.lookup(key, tt.now().UnixNano())
+	return found
+}
+
+// Remove deletes key and reports whether it was present and not expired.
+func (tt *TTLTable) Remove(key int) bool {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	ref, found := tt.lookup(key, tt.now().UnixNano())
+	if found {
+		tt.clear(ref)
+	}
+	return found
+}
+
+// Size returns the number of keys, including expired keys that have not been
+// reclaimed yet.
+func (tt *TTLTable) Size() int {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	return tt.t.Size()
+}
+
+// Capacity returns the maximum number of keys.
+func (tt *TTLTable) Capacity() int {
+	return tt.t.Capacity()
+}
+
+// Range calls fn for every key that has not expired until fn returns false.
+// The table is locked meanwhile, so fn must not use it.
+func (tt *TTLTable) Range(fn func(key int) bool) {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	now := tt.now().UnixNano()
+	for i, exps := range tt.expires {
+		for pos, v := range tt.t.segment(i) {
+			if v == EMPTY || v == TOMBSTONE || (exps[pos] != 0 && now >= exps[pos]) {
+				continue
+			}
+			if !fn(v) {
+				return
+			}
+		}
+	}
+}
+
+// Sweep reclaims the slots of all expired keys and returns how many were
+// reclaimed. The table is locked one level at a time, so other operations
+// can proceed between levels.
+func (tt *TTLTable) Sweep() int {
+	n := 0
+	for i := range tt.expires {
+		tt.mu.Lock()
+		n += tt.sweepSegment(i, tt.now().UnixNano())
+		tt.mu.Unlock()
+	}
+	return n
+}
+
+// sweepSegment reclaims the expired slots of one segment. Caller holds tt.mu.
+func (tt *TTLTable) sweepSegment(i int, now int64) int {
+	n := 0
+	seg := tt.t.segment(i)
+	for pos, exp := range tt.expires[i] {
+		if exp != 0 && now >= exp && seg[pos] != EMPTY && seg[pos] != TOMBSTONE {
+			tt.clear(slotRef{i, pos})
+			seg = tt.t.segment(i) // clear may have copied a shared segment
+			n++
+		}
+	}
+	return n
+}
+
+// StartSweeper runs Sweep every interval in a background goroutine until the
+// returned stop function is called.
+func (tt *TTLTable) StartSweeper(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				tt.Sweep()
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
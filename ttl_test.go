@@ -0,0 +1,87 @@
+package elastichash
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTTLTable(t *testing.T) {
+	now := time.Unix(1000, 0)
+	clock := func() time.Time { return now }
+
+	opts := &TTLOptions{DefaultTTL: time.Minute, Clock: clock}
+	forEachTable(t, NewTTLElasticTable(100, 0.2, opts), NewTTLFunnelTable(100, 4, 0.2, opts), func(t *testing.T, tt *TTLTable) {
+		now = time.Unix(1000, 0)
+		for k := 0; k < 40; k++ {
+			if err := tt.InsertTTL(k, time.Duration(k+1)*time.Second); err != nil {
+				t.Fatal(err)
+			}
+		}
+		tt.Insert(100)       // default TTL, one minute
+		tt.InsertTTL(101, 0) // never expires
+
+		now = now.Add(10 * time.Second)
+		for k := 0; k < 40; k++ {
+			if tt.Contains(k) != (k >= 10) {
+				t.Errorf("After 10s Contains(%d) should be %v", k, k >= 10)
+			}
+		}
+		// Lookups tombstoned the ten expired keys
+		if tt.Size() != 32 {
+			t.Errorf("Expected size 32 after lazy expiry, got %d", tt.Size())
+		}
+
+		// Re-inserting refreshes the expiration
+		tt.InsertTTL(20, time.Hour)
+		now = now.Add(30 * time.Second)
+		if !tt.Contains(20) || tt.Contains(25) || !tt.Contains(100) {
+			t.Errorf("Refreshed key should live on, others expire")
+		}
+		if tt.Remove(30) {
+			t.Errorf("Remove of an expired key should report false")
+		}
+
+		// The sweeper reclaims keys no lookup touches
+		now = now.Add(time.Hour)
+		if n := tt.Sweep(); n == 0 {
+			t.Errorf("Sweep should reclaim expired keys")
+		}
+		if tt.Size() != 1 || !tt.Contains(101) {
+			t.Errorf("Only the key without TTL should remain, size %d", tt.Size())
+		}
+		count := 0
+		tt.Range(func(int) bool { count++; return true })
+		if count != 1 {
+			t.Errorf("Range should visit 1 key, visited %d", count)
+		}
+
+		// A full table reclaims expired slots before failing
+		for k := 1000; tt.Size() < tt.Capacity(); k++ {
+			tt.InsertTTL(k, time.Second)
+		}
+		if tt.Insert(5000) == nil {
+			t.Errorf("Insert into a full table should fail")
+		}
+		now = now.Add(2 * time.Second)
+		if err := tt.Insert(5000); err != nil || !tt.Contains(5000) {
+			t.Errorf("Insert should succeed once expired slots are reclaimed: %v", err)
+		}
+	})
+}
+
+func TestTTLSweeper(t *testing.T) {
+	tt := NewTTLFunnelTable(100, 4, 0.2, nil)
+	for k := 0; k < 20; k++ {
+		tt.InsertTTL(k, time.Millisecond)
+	}
+	stop := tt.StartSweeper(time.Millisecond)
+	defer stop()
+	deadline := time.Now().Add(5 * time.Second)
+	for tt.Size() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if tt.Size() != 0 {
+		t.Errorf("Background sweeper left %d keys", tt.Size())
+	}
+	stop()
+}